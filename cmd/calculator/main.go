@@ -26,13 +26,13 @@ func main() {
 	defer db.Close()
 
 	auth := auth.New(secret, cfg.TokenTTL, db)
-	orch := orchestrator.New(secret, db)
+	orch := orchestrator.New(secret, db, cfg.OperationTimes())
 
 	application := app.New(*auth, *orch, cfg.Port, cfg.GRPCPort)
 	go application.MustRunGRPC()
 	go application.MustRunAPI()
 
-	agnt := agent.New(db, cfg.GRPCPort, cfg.TimeAdditon, cfg.TimeSubtraction, cfg.TimeMultiplications, cfg.TimeDivisions, cfg.ComputingPower)
+	agnt := agent.New(db, cfg.GRPCPort, cfg.OperationTimes(), cfg.ComputingPower)
 	go agnt.MustRun()
 
 	log.Printf("services are running, port: %d, GRPC port: %d\n", cfg.Port, cfg.GRPCPort)
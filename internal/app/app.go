@@ -47,9 +47,22 @@ func (a *App) MustRunAPI() {
 	r.HandleFunc("/api/v1/login", a.auth.Login).Methods("POST")
 
 	r.HandleFunc("/api/v1/calculate", a.orch.Calculate).Methods("POST")
+	r.HandleFunc("/api/v1/scripts", a.orch.Script).Methods("POST")
+	r.HandleFunc("/api/v1/derivative", a.orch.Derivative).Methods("POST")
+	r.HandleFunc("/api/v1/format", a.orch.Format).Methods("GET")
+	r.HandleFunc("/api/v1/render", a.orch.Render).Methods("GET")
 	r.HandleFunc("/api/v1/expressions", a.orch.Expressions).Methods("GET")
 	r.HandleFunc("/api/v1/expressions/{id}", a.orch.Expression).Methods("GET")
 
+	r.HandleFunc("/api/v1/functions", a.orch.Functions).Methods("GET")
+	r.HandleFunc("/api/v1/functions", a.orch.AddFunction).Methods("POST")
+
+	r.HandleFunc("/api/v1/variables", a.orch.Variables).Methods("GET")
+	r.HandleFunc("/api/v1/variables", a.orch.AddVariable).Methods("POST")
+	r.HandleFunc("/api/v1/variables/{name}", a.orch.Variable).Methods("GET")
+	r.HandleFunc("/api/v1/variables/{name}", a.orch.UpdateVariable).Methods("PUT")
+	r.HandleFunc("/api/v1/variables/{name}", a.orch.DeleteVariable).Methods("DELETE")
+
 	if err := http.ListenAndServe(":"+a.port, r); err != nil {
 		panic("service startup error")
 	}
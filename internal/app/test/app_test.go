@@ -9,10 +9,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
 	authModels "github.com/kingofhandsomes/calculator-go/internal/models/auth"
 	orchModels "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
 	"github.com/kingofhandsomes/calculator-go/internal/transport/agent"
@@ -39,11 +42,25 @@ func TestApp(t *testing.T) {
 		t.Fatalf("error creating table users, error: %s", err)
 	}
 
-	if _, err := db.Exec("CREATE TABLE expressions (login TEXT NOT NULL, id_expression INTEGER NOT NULL, expression TEXT NOT NULL, stat TEXT NOT NULL, result REAL NULL, FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+	if _, err := db.Exec("CREATE TABLE expressions (login TEXT NOT NULL, id_expression INTEGER NOT NULL, expression TEXT NOT NULL, stat TEXT NOT NULL, result REAL NULL, imag_result REAL NULL, precision TEXT NOT NULL DEFAULT 'float', exact_result TEXT NULL, variables TEXT NULL, root INTEGER NULL, saved_tasks INTEGER NOT NULL DEFAULT 0, unit TEXT NULL, shape TEXT NULL, value TEXT NULL, canonical TEXT NULL, latex TEXT NULL, FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
 		t.Fatalf("error creating table expressions, error: %s", err)
 	}
 
-	if _, err := db.Exec("CREATE TABLE tasks (login TEXT NOT NULL, id_expression INTEGER NOT NULL, id_task INTEGER NOT NULL, arg1 REAL NOT NULL, arg2 REAL NOT NULL, operation STRING NOT NULL, stat STRING NOT NULL, operation_time INTEGER NULL, result REAL NULL)"); err != nil {
+	if _, err := db.Exec("CREATE TABLE variables (login TEXT NOT NULL, name TEXT NOT NULL, value REAL NOT NULL, PRIMARY KEY (login, name), FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+		t.Fatalf("error creating table variables, error: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE functions (login TEXT NOT NULL, name TEXT NOT NULL, params TEXT NOT NULL, body TEXT NOT NULL, PRIMARY KEY (login, name), FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+		t.Fatalf("error creating table functions, error: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE bindings (login TEXT NOT NULL, id_expression INTEGER NOT NULL, position INTEGER NOT NULL, name TEXT NOT NULL, id_task INTEGER NULL, result REAL NULL, imag_result REAL NULL, exact_result TEXT NULL, unit TEXT NULL, FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+		t.Fatalf("error creating table bindings, error: %s", err)
+	}
+
+	if _, err := db.Exec("CREATE TABLE elements (login TEXT NOT NULL, id_expression INTEGER NOT NULL, position INTEGER NOT NULL, id_task INTEGER NULL, result REAL NULL, imag_result REAL NULL, exact_result TEXT NULL, FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+		t.Fatalf("error creating table elements, error: %s", err)
+	}
+
+	if _, err := db.Exec("CREATE TABLE tasks (login TEXT NOT NULL, id_expression INTEGER NOT NULL, id_task INTEGER NOT NULL, arg1 REAL NULL, arg2 REAL NULL, imag1 REAL NULL, imag2 REAL NULL, exact_arg1 TEXT NULL, exact_arg2 TEXT NULL, dep1 INTEGER NULL, dep2 INTEGER NULL, cond INTEGER NULL, branch INTEGER NULL, operation STRING NOT NULL, precision TEXT NOT NULL DEFAULT 'float', stat STRING NOT NULL, operation_time INTEGER NULL, result REAL NULL, imag_result REAL NULL, exact_result TEXT NULL)"); err != nil {
 		t.Fatalf("error creating table tasks, error: %s", err)
 	}
 
@@ -51,6 +68,19 @@ func TestApp(t *testing.T) {
 	ttl := time.Duration(time.Hour)
 	grpc_port := 44044
 	duration := time.Duration(time.Millisecond)
+	durations := map[string]time.Duration{"+": duration, "-": duration, "*": duration, "/": duration, "^": duration, "%": duration, "//": duration, "!": duration}
+	for _, oper := range expr.Comparisons {
+		durations[oper] = duration
+	}
+	for _, oper := range expr.Keywords {
+		durations[oper] = duration
+	}
+	for _, oper := range expr.Bitwise {
+		durations[oper] = duration
+	}
+	for name := range expr.Functions {
+		durations[name] = duration
+	}
 
 	a := auth.New(secret, ttl, db)
 
@@ -158,10 +188,11 @@ func TestApp(t *testing.T) {
 		})
 	}
 
-	o := orchestrator.New(secret, db)
+	o := orchestrator.New(secret, db, durations)
 
 	testCalculateCases := []struct {
 		name, login, password, expression string
+		precision                         string
 		ttl                               time.Duration
 		expectedStatusCode                int
 	}{
@@ -181,6 +212,105 @@ func TestApp(t *testing.T) {
 			ttl:                ttl,
 			expectedStatusCode: 201,
 		},
+		{
+			name:               "calculate: add decimal expression to roman1",
+			login:              "roman1",
+			password:           "qwerty1",
+			expression:         "2.5*4-1e-1",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add power expression to roman1",
+			login:              "roman1",
+			password:           "qwerty1",
+			expression:         "2^3^2-2**3",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add modulo expression to roman1",
+			login:              "roman1",
+			password:           "qwerty1",
+			expression:         "-7%3+17//5",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add functions expression to roman1",
+			login:              "roman1",
+			password:           "qwerty1",
+			expression:         "sqrt(16)+max(3,7,1,abs(-9))*round(2.4)",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add exact expression to roman1",
+			login:              "roman1",
+			password:           "qwerty1",
+			expression:         "123456789*987654321+1/3*3-2^-2",
+			precision:          "exact",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add exact fraction expression to roman",
+			login:              "roman",
+			password:           "qwerty",
+			expression:         "1/3+1/6",
+			precision:          "exact",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add complex expression to roman",
+			login:              "roman",
+			password:           "qwerty",
+			expression:         "(1+2i)*(3-i)",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add complex square root to roman",
+			login:              "roman",
+			password:           "qwerty",
+			expression:         "sqrt(-4)",
+			precision:          "complex",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add conditional expression to roman",
+			login:              "roman",
+			password:           "qwerty",
+			expression:         "if(2 > 3, 1/0, 7) + (1 <= 1 and not 0)",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add nested conditional expression to roman",
+			login:              "roman",
+			password:           "qwerty",
+			expression:         "if(1 > 0, if(0 > 1, 1/0, 2), sqrt(-1))",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add bitwise expression to roman1",
+			login:              "roman1",
+			password:           "qwerty1",
+			expression:         "(0xFF & 0b1010 | 0o17) << 2 >> 1",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
+		{
+			name:               "calculate: add postfix expression to roman1",
+			login:              "roman1",
+			password:           "qwerty1",
+			expression:         "10! + 200*15%",
+			ttl:                ttl,
+			expectedStatusCode: 201,
+		},
 		{
 			name:               "calculate: invalid expression",
 			login:              "roman",
@@ -206,7 +336,7 @@ func TestApp(t *testing.T) {
 				t.Fatalf("error creating jwt token, error: %s", err)
 			}
 
-			req, _ := json.Marshal(orchModels.CalculateRequest{Expression: ts.expression})
+			req, _ := json.Marshal(orchModels.CalculateRequest{Expression: ts.expression, Precision: ts.precision})
 
 			if ts.name == "calculate: invalid json" {
 				req = nil
@@ -228,6 +358,25 @@ func TestApp(t *testing.T) {
 		})
 	}
 
+	t.Run("scripts: add script to roman", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(ttl, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		req, _ := json.Marshal(orchModels.ScriptRequest{Script: "a = 3*4; b = a+2; a*b"})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/scripts", bytes.NewBuffer(req))
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+
+		o.Script(w, r)
+
+		if w.Result().StatusCode != 201 {
+			t.Errorf("invalid status code, got: %d, want: %d", w.Result().StatusCode, 201)
+		}
+	})
+
 	go func() {
 		l, _ := net.Listen("tcp", fmt.Sprintf("localhost:%d", grpc_port))
 		grpcServer := grpc.NewServer()
@@ -235,7 +384,7 @@ func TestApp(t *testing.T) {
 		grpcServer.Serve(l)
 	}()
 
-	agnt := agent.New(db, grpc_port, duration, duration, duration, duration, 3)
+	agnt := agent.New(db, grpc_port, durations, 3)
 	go agnt.MustRun()
 
 	var wg sync.WaitGroup
@@ -251,13 +400,268 @@ func TestApp(t *testing.T) {
 					k++
 				}
 			}
-			if k == 2 {
+			if k == 15 {
 				break
 			}
 		}
 	}()
 	wg.Wait()
 
+	t.Run("expressions: exact result", func(t *testing.T) {
+		var exact string
+		db.QueryRow("SELECT exact_result FROM expressions WHERE login = 'roman1' AND precision = 'exact'").Scan(&exact)
+		if exact != "487730524450541079/4" {
+			t.Errorf("invalid exact result, got: %s, want: %s", exact, "487730524450541079/4")
+		}
+
+		db.QueryRow("SELECT exact_result FROM expressions WHERE login = 'roman' AND precision = 'exact'").Scan(&exact)
+		if exact != "1/2" {
+			t.Errorf("invalid exact result, got: %s, want: %s", exact, "1/2")
+		}
+	})
+
+	t.Run("expressions: complex results", func(t *testing.T) {
+		var re, im float64
+		db.QueryRow("SELECT result, imag_result FROM expressions WHERE login = 'roman' AND expression = '(1+2i)*(3-i)'").Scan(&re, &im)
+		if re != 5 || im != 5 {
+			t.Errorf("invalid complex result, got: %v%+vi, want: 5+5i", re, im)
+		}
+
+		db.QueryRow("SELECT result, imag_result FROM expressions WHERE login = 'roman' AND expression = 'sqrt(-4)'").Scan(&re, &im)
+		if re != 0 || im != 2 {
+			t.Errorf("invalid complex result, got: %v%+vi, want: 0+2i", re, im)
+		}
+	})
+
+	t.Run("expressions: complex result in formats and bases", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(ttl, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		testComplexCases := []struct {
+			expression, query                  string
+			expectedResult, expectedBaseResult string
+		}{
+			{expression: "(1+2i)*(3-i)", query: "?base=16"},
+			{expression: "(1+2i)*(3-i)", query: "?format=fraction", expectedResult: "5+5i"},
+			{expression: "sqrt(-4)", query: "?format=mixed", expectedResult: "2i"},
+		}
+		for _, ts := range testComplexCases {
+			var id string
+			db.QueryRow("SELECT id_expression FROM expressions WHERE login = 'roman' AND expression = $1", ts.expression).Scan(&id)
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+id+ts.query, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": id})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Expression(w, r)
+			var expression map[string]orchModels.ExpressionResponse
+			if err := json.NewDecoder(w.Result().Body).Decode(&expression); err != nil {
+				t.Fatalf("invalid json decode, error: %s", err)
+			}
+			if got := expression["expression"]; got.ExactResult != ts.expectedResult || got.BaseResult != ts.expectedBaseResult {
+				t.Errorf("invalid result of %s%s, got: %q and %q, want: %q and %q", ts.expression, ts.query, got.ExactResult, got.BaseResult, ts.expectedResult, ts.expectedBaseResult)
+			}
+		}
+	})
+
+	t.Run("expressions: fraction of a float result", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(ttl, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		req, _ := json.Marshal(orchModels.CalculateRequest{Expression: "-7/3", Precision: "float"})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.Calculate(w, r)
+		var created orchModels.CalculateResponse
+		if err := json.NewDecoder(w.Result().Body).Decode(&created); err != nil || w.Result().StatusCode != 201 {
+			t.Fatalf("invalid response, got: %d, error: %v", w.Result().StatusCode, err)
+		}
+
+		var stat string
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline) && stat != "calculated"; time.Sleep(10 * time.Millisecond) {
+			db.QueryRow("SELECT stat FROM expressions WHERE login = 'roman' AND id_expression = $1", created.Id).Scan(&stat)
+		}
+
+		id := fmt.Sprint(created.Id)
+		for format, want := range map[string]string{"fraction": "-7/3", "mixed": "-2 1/3"} {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+id+"?format="+format, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": id})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Expression(w, r)
+			var expression map[string]orchModels.ExpressionResponse
+			if err := json.NewDecoder(w.Result().Body).Decode(&expression); err != nil {
+				t.Fatalf("invalid json decode, error: %s", err)
+			}
+			if got := expression["expression"].ExactResult; got != want {
+				t.Errorf("invalid %s of -7/3 in floats, got: %s, want: %s", format, got, want)
+			}
+		}
+	})
+
+	t.Run("expressions: decimal of a large float result", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(ttl, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		// 1e22 is an exact float, the float of 1e300 isn't, its shortest decimal is printed
+		for expression, want := range map[string]string{"1e300": "1" + strings.Repeat("0", 300), "1e22": "1" + strings.Repeat("0", 22)} {
+			req, _ := json.Marshal(orchModels.CalculateRequest{Expression: expression, Precision: "float"})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Calculate(w, r)
+			var created orchModels.CalculateResponse
+			if err := json.NewDecoder(w.Result().Body).Decode(&created); err != nil || w.Result().StatusCode != 201 {
+				t.Fatalf("invalid response to %s, got: %d, error: %v", expression, w.Result().StatusCode, err)
+			}
+
+			id := fmt.Sprint(created.Id)
+			r = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+id+"?format=decimal", nil)
+			r = mux.SetURLVars(r, map[string]string{"id": id})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w = httptest.NewRecorder()
+			o.Expression(w, r)
+			var got map[string]orchModels.ExpressionResponse
+			if err := json.NewDecoder(w.Result().Body).Decode(&got); err != nil {
+				t.Fatalf("invalid json decode, error: %s", err)
+			}
+			if got["expression"].ExactResult != want {
+				t.Errorf("invalid decimal of %s, got: %s, want: %s", expression, got["expression"].ExactResult, want)
+			}
+		}
+	})
+
+	t.Run("expressions: conditional results", func(t *testing.T) {
+		for id, want := range map[int]float64{5: 8, 6: 2} {
+			var result float64
+			db.QueryRow("SELECT result FROM expressions WHERE login = 'roman' AND id_expression = $1", id).Scan(&result)
+			if result != want {
+				t.Errorf("invalid result of expression %d, got: %v, want: %v", id, result, want)
+			}
+		}
+	})
+
+	t.Run("expressions: bitwise result", func(t *testing.T) {
+		var result float64
+		db.QueryRow("SELECT result FROM expressions WHERE login = 'roman1' AND canonical = '(0xFF & 0b1010 | 0o17) << 2 >> 1'").Scan(&result)
+		if result != 30 {
+			t.Errorf("invalid result of bitwise expression, got: %v, want: %v", result, 30)
+		}
+	})
+
+	t.Run("expressions: postfix result", func(t *testing.T) {
+		var result float64
+		db.QueryRow("SELECT result FROM expressions WHERE login = 'roman1' AND canonical = '10! + 200 * 15%'").Scan(&result)
+		if result != 3628830 {
+			t.Errorf("invalid result of postfix expression, got: %v, want: %v", result, 3628830)
+		}
+	})
+
+	t.Run("expressions: script result and bindings", func(t *testing.T) {
+		var result float64
+		db.QueryRow("SELECT result FROM expressions WHERE login = 'roman' AND id_expression = 7").Scan(&result)
+		if result != 168 {
+			t.Errorf("invalid result of script, got: %v, want: %v", result, 168)
+		}
+
+		for name, want := range map[string]float64{"a": 12, "b": 14} {
+			var value float64
+			db.QueryRow("SELECT t.result FROM bindings AS b JOIN tasks AS t ON t.login = b.login AND t.id_expression = b.id_expression AND t.id_task = b.id_task WHERE b.login = 'roman' AND b.id_expression = 7 AND b.name = $1", name).Scan(&value)
+			if value != want {
+				t.Errorf("invalid value of binding %s, got: %v, want: %v", name, value, want)
+			}
+		}
+	})
+
+	t.Run("expressions: exact result too large for floats", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(ttl, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		req, _ := json.Marshal(orchModels.CalculateRequest{Expression: "200!", Precision: "exact"})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.Calculate(w, r)
+		var created orchModels.CalculateResponse
+		if err := json.NewDecoder(w.Result().Body).Decode(&created); err != nil || w.Result().StatusCode != 201 {
+			t.Fatalf("invalid response, got: %d, error: %v", w.Result().StatusCode, err)
+		}
+
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			var stat string
+			db.QueryRow("SELECT stat FROM expressions WHERE login = 'roman' AND id_expression = $1", created.Id).Scan(&stat)
+			if stat == "calculated" {
+				break
+			}
+		}
+
+		id := fmt.Sprint(created.Id)
+		r = httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+id, nil)
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+		r.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		o.Expression(w, r)
+		if w.Result().StatusCode != 200 {
+			t.Fatalf("invalid status code of the expression, got: %d, want: 200", w.Result().StatusCode)
+		}
+		var expression map[string]orchModels.ExpressionResponse
+		if err := json.NewDecoder(w.Result().Body).Decode(&expression); err != nil {
+			t.Fatalf("invalid json decode, error: %s", err)
+		}
+		if got := expression["expression"]; got.Status != "calculated" || got.Result != nil || len(got.ExactResult) != 375 {
+			t.Errorf("invalid result of 200!, got: %s %v with %d digits, want: calculated without result and 375 digits", got.Status, got.Result, len(got.ExactResult))
+		}
+
+		r = httptest.NewRequest(http.MethodGet, "/api/v1/expressions", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		o.Expressions(w, r)
+		if w.Result().StatusCode != 200 {
+			t.Errorf("invalid status code of the expressions, got: %d, want: 200", w.Result().StatusCode)
+		}
+	})
+
+	t.Run("expressions: power too large for floats", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(ttl, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		for _, ts := range []struct{ expression, precision string }{{"10^400", "float"}, {"10^400", "complex"}, {"(2+i)^2000", "complex"}} {
+			expression := ts.expression
+			req, _ := json.Marshal(orchModels.CalculateRequest{Expression: expression, Precision: ts.precision})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Calculate(w, r)
+			var created orchModels.CalculateResponse
+			if err := json.NewDecoder(w.Result().Body).Decode(&created); err != nil || w.Result().StatusCode != 201 {
+				t.Fatalf("invalid response to %s, got: %d, error: %v", expression, w.Result().StatusCode, err)
+			}
+
+			var stat string
+			for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline) && stat != "error"; time.Sleep(10 * time.Millisecond) {
+				db.QueryRow("SELECT stat FROM expressions WHERE login = 'roman' AND id_expression = $1", created.Id).Scan(&stat)
+			}
+			if stat != "error" {
+				t.Errorf("invalid status of %s, got: %s, want: error", expression, stat)
+			}
+			var result sql.NullFloat64
+			db.QueryRow("SELECT result FROM expressions WHERE login = 'roman' AND id_expression = $1", created.Id).Scan(&result)
+			if result.Valid {
+				t.Errorf("invalid result of %s, got: %v, want: null", expression, result.Float64)
+			}
+		}
+	})
+
 	testExpressionsCases := []struct {
 		name, login, password string
 		ttl                   time.Duration
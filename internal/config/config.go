@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
 )
 
 type Config struct {
@@ -16,6 +17,13 @@ type Config struct {
 	TimeSubtraction     time.Duration `yaml:"TIME_SUBTRACTION_MS" env-required:"true"`
 	TimeMultiplications time.Duration `yaml:"TIME_MULTIPLICATIONS_MS" env-required:"true"`
 	TimeDivisions       time.Duration `yaml:"TIME_DIVISIONS_MS" env-required:"true"`
+	TimePower           time.Duration `yaml:"TIME_POWER_MS" env-required:"true"`
+	TimeModulo          time.Duration `yaml:"TIME_MODULO_MS" env-required:"true"`
+	TimeIntegerDivision time.Duration `yaml:"TIME_INTEGER_DIVISION_MS" env-required:"true"`
+	TimeFunctions       time.Duration `yaml:"TIME_FUNCTIONS_MS" env-required:"true"`
+	TimeComparison      time.Duration `yaml:"TIME_COMPARISON_MS" env-required:"true"`
+	TimeLogic           time.Duration `yaml:"TIME_LOGIC_MS" env-required:"true"`
+	TimeBitwise         time.Duration `yaml:"TIME_BITWISE_MS" env-required:"true"`
 	ComputingPower      int           `yaml:"COMPUTING_POWER" env-required:"true"`
 	Port                int           `yaml:"port" env-required:"true"`
 	GRPCPort            int           `yaml:"grpc_port" env-required:"true"`
@@ -40,6 +48,35 @@ func MustLoad() *Config {
 	return &cfg
 }
 
+// OperationTimes returns the time of computing for every operation of the tasks.
+// The time of a function is TIME_FUNCTIONS_MS multiplied by the cost of the function.
+func (c *Config) OperationTimes() map[string]time.Duration {
+	times := map[string]time.Duration{
+		"+":  c.TimeAdditon,
+		"-":  c.TimeSubtraction,
+		"*":  c.TimeMultiplications,
+		"/":  c.TimeDivisions,
+		"^":  c.TimePower,
+		"%":  c.TimeModulo,
+		"//": c.TimeIntegerDivision,
+		// a task of the factorial is a partial product
+		"!": c.TimeMultiplications,
+	}
+	for _, oper := range expr.Comparisons {
+		times[oper] = c.TimeComparison
+	}
+	for _, oper := range expr.Keywords {
+		times[oper] = c.TimeLogic
+	}
+	for _, oper := range expr.Bitwise {
+		times[oper] = c.TimeBitwise
+	}
+	for name, fn := range expr.Functions {
+		times[name] = c.TimeFunctions * time.Duration(fn.Cost)
+	}
+	return times
+}
+
 func fetchConfigPath() string {
 	var res string
 
@@ -9,4 +9,13 @@ var (
 	ErrRequestJSON         = errors.New("request with invalid json")
 	ErrExpressionId        = errors.New("invalid id of expression")
 	ErrTokenExpired        = errors.New("the validity period of the jwt token has expired")
+	ErrPrecision           = errors.New("invalid precision, expected float, exact or complex")
+	ErrFormat              = errors.New("invalid format, expected decimal, fraction, mixed or latex")
+	ErrBase                = errors.New("invalid base, expected 2, 8, 10 or 16")
+	ErrDryRun              = errors.New("invalid dry_run, expected true or false")
+	ErrImplicit            = errors.New("invalid implicit_multiplication, expected true or false")
+	ErrVariableName        = errors.New("invalid name of variable")
+	ErrVariableExists      = errors.New("variable with such name exists")
+	ErrVariableNotFound    = errors.New("variable with such name does not exist")
+	ErrFunctionExists      = errors.New("function with such name exists")
 )
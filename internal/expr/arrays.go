@@ -0,0 +1,131 @@
+package expr
+
+import (
+	"fmt"
+	"slices"
+)
+
+// MaxDeterminant is the largest size of a matrix whose determinant can be computed,
+// the number of its tasks grows as n*2^n.
+const MaxDeterminant = 8
+
+// elementwise are the functions of one number that are applied to every element of an array.
+var elementwise = []string{"abs", "sqrt", "round", "log", "sin", "cos"}
+
+// Shape returns the shape of the value of the tree: nil for a number, [n] for a vector
+// of n elements and [rows, columns] for a matrix. It checks that the shapes of the operands
+// agree: arithmetic applies to the elements of arrays of the same shape or of an array
+// and a number, dot needs two vectors of the same length, det needs a square matrix.
+// names are the shapes of the names bound by a script.
+func Shape(n Node, names map[string][]int) ([]int, error) {
+	switch n := n.(type) {
+	case *Ident:
+		return names[n.Name], nil
+	case *Array:
+		var elem []int
+		for i, e := range n.Elems {
+			s, err := Shape(e, names)
+			if err != nil {
+				return nil, err
+			}
+			if i > 0 && !slices.Equal(s, elem) {
+				return nil, errorf(CodeShapeMismatch, e.Pos(), "elements of an array must have the same shape, got %s and %s", shapeName(elem), shapeName(s))
+			}
+			elem = s
+		}
+		if len(elem) > 1 {
+			return nil, errorf(CodeShapeMismatch, n.Position, "only vectors and matrices are supported")
+		}
+		return append([]int{len(n.Elems)}, elem...), nil
+	case *Unary:
+		x, err := Shape(n.X, names)
+		if err == nil && x != nil && n.Op == "not" {
+			return nil, errorf(CodeShapeMismatch, n.Position, "'not' expects a number, got %s", shapeName(x))
+		}
+		return x, err
+	case *Binary:
+		x, err := Shape(n.X, names)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == Conversion {
+			if x != nil {
+				return nil, errorf(CodeShapeMismatch, n.Position, "only a number can be converted, got %s", shapeName(x))
+			}
+			return nil, nil
+		}
+		y, err := Shape(n.Y, names)
+		if err != nil {
+			return nil, err
+		}
+		if (n.Op == "and" || n.Op == "or") && (x != nil || y != nil) {
+			return nil, errorf(CodeShapeMismatch, n.Position, "'%s' expects numbers", n.Op)
+		}
+		switch {
+		case x == nil:
+			return y, nil
+		case y == nil || slices.Equal(x, y):
+			return x, nil
+		}
+		return nil, errorf(CodeShapeMismatch, n.Position, "shapes %s and %s don't match", shapeName(x), shapeName(y))
+	case *Call:
+		shapes := make([][]int, len(n.Args))
+		for i, arg := range n.Args {
+			s, err := Shape(arg, names)
+			if err != nil {
+				return nil, err
+			}
+			shapes[i] = s
+		}
+		switch {
+		case n.Func == "dot":
+			if len(shapes[0]) != 1 || !slices.Equal(shapes[0], shapes[1]) {
+				return nil, errorf(CodeShapeMismatch, n.Position, "dot expects two vectors of the same length, got %s and %s", shapeName(shapes[0]), shapeName(shapes[1]))
+			}
+			return nil, nil
+		case n.Func == "transpose":
+			if len(shapes[0]) != 2 {
+				return nil, errorf(CodeShapeMismatch, n.Position, "transpose expects a matrix, got %s", shapeName(shapes[0]))
+			}
+			return []int{shapes[0][1], shapes[0][0]}, nil
+		case n.Func == "det":
+			if len(shapes[0]) != 2 || shapes[0][0] != shapes[0][1] {
+				return nil, errorf(CodeShapeMismatch, n.Position, "det expects a square matrix, got %s", shapeName(shapes[0]))
+			}
+			if shapes[0][0] > MaxDeterminant {
+				return nil, errorf(CodeShapeMismatch, n.Position, "det supports matrices up to %dx%d", MaxDeterminant, MaxDeterminant)
+			}
+			return nil, nil
+		case slices.Contains(elementwise, n.Func) && len(n.Args) == 1:
+			return shapes[0], nil
+		}
+		for i, s := range shapes {
+			if s != nil {
+				return nil, errorf(CodeShapeMismatch, n.Args[i].Pos(), "function '%s' expects a number, got %s", n.Func, shapeName(s))
+			}
+		}
+	}
+	return nil, nil
+}
+
+// HasArray reports whether the tree contains a vector or a matrix literal.
+func HasArray(n Node) bool {
+	found := false
+	Walk(n, func(n Node) error {
+		if _, ok := n.(*Array); ok {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+func shapeName(s []int) string {
+	switch len(s) {
+	case 0:
+		return "number"
+	case 1:
+		return fmt.Sprintf("vector of %d", s[0])
+	}
+	return fmt.Sprintf("%dx%d matrix", s[0], s[1])
+}
@@ -0,0 +1,152 @@
+package expr
+
+import (
+	"slices"
+	"strings"
+)
+
+// Node is an element of the syntax tree of an expression.
+// Pos returns the offset of the character in the expression where the node starts.
+type Node interface {
+	Pos() int
+}
+
+// Number is a number literal. An imaginary number, for example 2i, has Imag set
+// and Value is its imaginary part. A quantity, for example 5 km, has the text of its unit in Unit.
+type Number struct {
+	Value    float64
+	Imag     bool
+	Text     string
+	Unit     string
+	Position int
+}
+
+// Binary is an operation with two operands, for example 1+2.
+type Binary struct {
+	Op       string
+	X, Y     Node
+	Position int
+}
+
+// Unary is an operation with one operand, for example -(2+3) or not x.
+type Unary struct {
+	Op       string
+	X        Node
+	Position int
+}
+
+// Ident is a name of a constant or a variable, for example pi.
+type Ident struct {
+	Name     string
+	Position int
+}
+
+// Call is a call of a built-in or a user-defined function, for example max(3,7).
+type Call struct {
+	Func     string
+	Args     []Node
+	Position int
+}
+
+// Array is a vector, for example [1,2,3], or a matrix whose elements are its rows, for example [[1,2],[3,4]].
+type Array struct {
+	Elems    []Node
+	Position int
+}
+
+func (n *Number) Pos() int { return n.Position }
+func (n *Ident) Pos() int  { return n.Position }
+func (n *Unary) Pos() int  { return n.Position }
+func (n *Binary) Pos() int { return n.Position }
+func (n *Call) Pos() int   { return n.Position }
+func (n *Array) Pos() int  { return n.Position }
+
+// Walk traverses the tree in post-order: the operands of a node are visited before the node itself,
+// which is the order of reverse polish notation. Traversal stops at the first error returned by fn.
+func Walk(n Node, fn func(Node) error) error {
+	for _, child := range children(n) {
+		if err := Walk(child, fn); err != nil {
+			return err
+		}
+	}
+	return fn(n)
+}
+
+func children(n Node) []Node {
+	switch n := n.(type) {
+	case *Unary:
+		return []Node{n.X}
+	case *Binary:
+		return []Node{n.X, n.Y}
+	case *Call:
+		return n.Args
+	case *Array:
+		return n.Elems
+	}
+	return nil
+}
+
+// String returns the expression with every operation enclosed in parentheses, for example ((1+2)*3).
+func String(n Node) string {
+	var sb strings.Builder
+	write(&sb, n)
+	return sb.String()
+}
+
+func write(sb *strings.Builder, n Node) {
+	switch n := n.(type) {
+	case *Number:
+		sb.WriteString(n.Text)
+		if n.Unit != "" {
+			sb.WriteString(" " + n.Unit)
+		}
+	case *Ident:
+		sb.WriteString(n.Name)
+	case *Unary:
+		sb.WriteByte('(')
+		if slices.Contains(Postfix, n.Op) {
+			write(sb, n.X)
+			sb.WriteString(n.Op + ")")
+			return
+		}
+		sb.WriteString(n.Op)
+		if n.Op == "not" {
+			sb.WriteByte(' ')
+		}
+		write(sb, n.X)
+		sb.WriteByte(')')
+	case *Binary:
+		sb.WriteByte('(')
+		write(sb, n.X)
+		if n.Op == Conversion {
+			sb.WriteString(" " + n.Op + " " + n.Y.(*Number).Unit + ")")
+			return
+		}
+		if slices.Contains(Keywords, n.Op) {
+			sb.WriteString(" " + n.Op + " ")
+		} else {
+			sb.WriteString(n.Op)
+		}
+		write(sb, n.Y)
+		sb.WriteByte(')')
+	case *Call:
+		sb.WriteString(n.Func)
+		sb.WriteByte('(')
+		for i, arg := range n.Args {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			write(sb, arg)
+		}
+		sb.WriteByte(')')
+	case *Array:
+		sb.WriteByte('[')
+		for i, elem := range n.Elems {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			write(sb, elem)
+		}
+		sb.WriteByte(']')
+	}
+}
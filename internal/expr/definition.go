@@ -0,0 +1,246 @@
+package expr
+
+import (
+	"slices"
+	"strings"
+)
+
+// maxInlinedNodes limits the size of a tree with inlined functions, a function that calls
+// the previous one twice doubles the tree, so a few definitions could make millions of tasks.
+const maxInlinedNodes = 10000
+
+// Definition is a user-defined function, for example f(x, y) = x^2 + y.
+// Its body can use only the parameters, the constants and calls of functions.
+type Definition struct {
+	Name   string
+	Params []string
+	Body   Node
+	// Text is the source of the body.
+	Text string
+}
+
+// ParseDefinition builds a function from its definition, funcs are the functions
+// that have already been defined and can be called from the body.
+//
+// Grammar:
+//
+//	definition = ident "(" ident { "," ident } ")" "=" expr
+//
+// A function that calls itself, directly or through other functions, is rejected.
+func ParseDefinition(src string, funcs map[string]*Definition) (*Definition, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	name := p.next()
+	if name.kind != ident {
+		return nil, unexpected(name)
+	}
+	if !IsName(name.text) {
+		return nil, errorf(CodeInvalidName, name.pos, "'%s' can't be a name of a function", name.text)
+	}
+	def := &Definition{Name: name.text}
+
+	open := p.next()
+	if open.kind != lparen {
+		return nil, unexpected(open)
+	}
+	for {
+		param := p.next()
+		if param.kind != ident {
+			return nil, unexpected(param)
+		}
+		if !IsName(param.text) {
+			return nil, errorf(CodeInvalidName, param.pos, "'%s' can't be a name of a parameter", param.text)
+		}
+		if slices.Contains(def.Params, param.text) {
+			return nil, errorf(CodeRedefinition, param.pos, "parameter '%s' is repeated", param.text)
+		}
+		def.Params = append(def.Params, param.text)
+		if p.peek().kind != comma {
+			break
+		}
+		p.next()
+	}
+	if err := p.closing(open); err != nil {
+		return nil, err
+	}
+	if tok := p.next(); tok.kind != assign {
+		return nil, unexpected(tok)
+	}
+
+	// the function can be called from its own body, such a call is found by Inline as recursion
+	visible := make(map[string]*Definition, len(funcs)+1)
+	for name, f := range funcs {
+		visible[name] = f
+	}
+	visible[def.Name] = def
+
+	def.Text = strings.TrimSpace(src[p.peek().pos:])
+	p.opts = Options{Functions: visible}
+	if def.Body, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != eof {
+		return nil, unexpected(tok)
+	}
+
+	err = Walk(def.Body, func(n Node) error {
+		id, ok := n.(*Ident)
+		if !ok || id.Name == Imaginary || slices.Contains(def.Params, id.Name) {
+			return nil
+		}
+		if _, ok := Constants[id.Name]; ok {
+			return nil
+		}
+		return errorf(CodeUnknownIdent, id.Position, "unknown name '%s' in function '%s'", id.Name, def.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := Inline(def.Body, visible); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// Inline returns a copy of the tree where every call of a function from funcs is replaced
+// with its body, the parameters of the body are replaced with the arguments of the call.
+// The nodes of an inlined body get the position of the call. A tree of more than
+// maxInlinedNodes nodes is rejected.
+func Inline(n Node, funcs map[string]*Definition) (Node, error) {
+	res, err := inline(n, funcs, nil, make(map[string]Node))
+	if err != nil {
+		return nil, err
+	}
+	if tooLarge(res) {
+		return nil, errorf(CodeTooLarge, n.Pos(), "expression has more than %d nodes after inlining functions", maxInlinedNodes)
+	}
+	return res, nil
+}
+
+// inline keeps the inlined bodies of the functions in bodies, so that every body is inlined once
+// and the arguments, which are already inlined, aren't walked again.
+func inline(n Node, funcs map[string]*Definition, calling []string, bodies map[string]Node) (Node, error) {
+	switch n := n.(type) {
+	case *Unary:
+		x, err := inline(n.X, funcs, calling, bodies)
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: n.Op, X: x, Position: n.Position}, nil
+	case *Binary:
+		x, err := inline(n.X, funcs, calling, bodies)
+		if err != nil {
+			return nil, err
+		}
+		y, err := inline(n.Y, funcs, calling, bodies)
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: n.Op, X: x, Y: y, Position: n.Position}, nil
+	case *Call:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			a, err := inline(arg, funcs, calling, bodies)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = a
+		}
+		def, ok := funcs[n.Func]
+		if !ok {
+			return &Call{Func: n.Func, Args: args, Position: n.Position}, nil
+		}
+		if slices.Contains(calling, n.Func) {
+			return nil, errorf(CodeRecursion, n.Position, "function '%s' calls itself", n.Func)
+		}
+		body, ok := bodies[n.Func]
+		if !ok {
+			var err error
+			if body, err = inline(def.Body, funcs, append(calling, n.Func), bodies); err != nil {
+				// an error in the body is reported at the call
+				if e, ok := err.(*Error); ok {
+					return nil, &Error{Code: e.Code, Pos: n.Position, Msg: e.Msg}
+				}
+				return nil, err
+			}
+			bodies[n.Func] = body
+		}
+		params := make(map[string]Node, len(def.Params))
+		for i, param := range def.Params {
+			params[param] = args[i]
+		}
+		if tooLarge(body) {
+			return nil, errorf(CodeTooLarge, n.Position, "function '%s' has more than %d nodes after inlining functions", n.Func, maxInlinedNodes)
+		}
+		res := substitute(body, params, n.Position)
+		if tooLarge(res) {
+			return nil, errorf(CodeTooLarge, n.Position, "call of '%s' has more than %d nodes after inlining functions", n.Func, maxInlinedNodes)
+		}
+		return res, nil
+	case *Array:
+		elems := make([]Node, len(n.Elems))
+		for i, elem := range n.Elems {
+			e, err := inline(elem, funcs, calling, bodies)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = e
+		}
+		return &Array{Elems: elems, Position: n.Position}, nil
+	}
+	return n, nil
+}
+
+// tooLarge reports whether the tree has more than maxInlinedNodes nodes, the arguments of inlined
+// calls are shared, so it stops counting at the limit instead of walking the whole tree.
+func tooLarge(n Node) bool {
+	size := 0
+	var walk func(Node) bool
+	walk = func(n Node) bool {
+		if size++; size > maxInlinedNodes {
+			return true
+		}
+		for _, child := range children(n) {
+			if walk(child) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(n)
+}
+
+// substitute copies the body of a function with the parameters replaced with the arguments.
+func substitute(n Node, params map[string]Node, pos int) Node {
+	switch n := n.(type) {
+	case *Number:
+		return &Number{Value: n.Value, Imag: n.Imag, Text: n.Text, Unit: n.Unit, Position: pos}
+	case *Ident:
+		if arg, ok := params[n.Name]; ok {
+			return arg
+		}
+		return &Ident{Name: n.Name, Position: pos}
+	case *Unary:
+		return &Unary{Op: n.Op, X: substitute(n.X, params, pos), Position: pos}
+	case *Binary:
+		return &Binary{Op: n.Op, X: substitute(n.X, params, pos), Y: substitute(n.Y, params, pos), Position: pos}
+	case *Call:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = substitute(arg, params, pos)
+		}
+		return &Call{Func: n.Func, Args: args, Position: pos}
+	case *Array:
+		elems := make([]Node, len(n.Elems))
+		for i, elem := range n.Elems {
+			elems[i] = substitute(elem, params, pos)
+		}
+		return &Array{Elems: elems, Position: pos}
+	}
+	return n
+}
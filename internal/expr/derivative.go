@@ -0,0 +1,111 @@
+package expr
+
+// Derivative returns the derivative of the tree with respect to the variable name, other names
+// are constants. The result is not simplified, SimplifySymbolic removes the multiplications by one and zero.
+// Operations without a derivative, like comparisons, the remainder, the factorial or min, are rejected.
+func Derivative(n Node, name string) (Node, error) {
+	pos := n.Pos()
+	switch n := n.(type) {
+	case *Number:
+		return literal(0, pos), nil
+	case *Ident:
+		if n.Name == name {
+			return literal(1, pos), nil
+		}
+		return literal(0, pos), nil
+	case *Unary:
+		if n.Op == "not" || n.Op == "!" {
+			break
+		}
+		dx, err := Derivative(n.X, name)
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: n.Op, X: dx, Position: pos}, nil
+	case *Binary:
+		u, v := n.X, n.Y
+		du, err := Derivative(u, name)
+		if err != nil {
+			return nil, err
+		}
+		dv, err := Derivative(v, name)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case "+", "-":
+			return binary(n.Op, du, dv, pos), nil
+		case "*":
+			// (uv)' = u'v + uv'
+			return binary("+", binary("*", du, v, pos), binary("*", u, dv, pos), pos), nil
+		case "/":
+			// (u/v)' = (u'v - uv') / v^2
+			return binary("/", binary("-", binary("*", du, v, pos), binary("*", u, dv, pos), pos), binary("^", v, literal(2, pos), pos), pos), nil
+		case "^", "**":
+			if !dependsOn(v, name) {
+				// (u^c)' = c u^(c-1) u'
+				return binary("*", binary("*", v, binary("^", u, binary("-", v, literal(1, pos), pos), pos), pos), du, pos), nil
+			}
+			if !dependsOn(u, name) {
+				// (a^v)' = a^v log(a) v'
+				return binary("*", binary("*", n, call("log", pos, u), pos), dv, pos), nil
+			}
+			// (u^v)' = u^v (v' log(u) + v u'/u)
+			return binary("*", n, binary("+", binary("*", dv, call("log", pos, u), pos), binary("/", binary("*", v, du, pos), u, pos), pos), pos), nil
+		}
+	case *Call:
+		if n.Func == "if" {
+			// the condition does not change near the point, except at the boundary
+			da, err := Derivative(n.Args[1], name)
+			if err != nil {
+				return nil, err
+			}
+			db, err := Derivative(n.Args[2], name)
+			if err != nil {
+				return nil, err
+			}
+			return call("if", pos, n.Args[0], da, db), nil
+		}
+		if len(n.Args) != 1 {
+			break
+		}
+		u := n.Args[0]
+		du, err := Derivative(u, name)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Func {
+		case "sqrt":
+			return binary("/", du, binary("*", literal(2, pos), n, pos), pos), nil
+		case "abs":
+			return binary("/", binary("*", du, u, pos), n, pos), nil
+		case "log":
+			return binary("/", du, u, pos), nil
+		case "sin":
+			return binary("*", call("cos", pos, u), du, pos), nil
+		case "cos":
+			return binary("*", &Unary{Op: "-", X: call("sin", pos, u), Position: pos}, du, pos), nil
+		}
+	}
+	return nil, errorf(CodeNotDifferentiable, pos, "'%s' has no derivative", String(n))
+}
+
+// dependsOn reports whether the tree contains the name.
+func dependsOn(n Node, name string) bool {
+	found := false
+	Walk(n, func(n Node) error {
+		if id, ok := n.(*Ident); ok && id.Name == name {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+func binary(op string, x, y Node, pos int) *Binary {
+	return &Binary{Op: op, X: x, Y: y, Position: pos}
+}
+
+func call(fn string, pos int, args ...Node) *Call {
+	return &Call{Func: fn, Args: args, Position: pos}
+}
@@ -0,0 +1,42 @@
+package expr
+
+import "fmt"
+
+// Codes of syntax errors.
+const (
+	CodeInvalidSymbol     = "invalid_symbol"
+	CodeInvalidNumber     = "invalid_number"
+	CodeUnexpectedToken   = "unexpected_token"
+	CodeUnexpectedEnd     = "unexpected_end"
+	CodeBracketMismatch   = "bracket_mismatch"
+	CodeDivisionByZero    = "division_by_zero"
+	CodeUnknownFunction   = "unknown_function"
+	CodeInvalidArity      = "invalid_arity"
+	CodeUnknownIdent      = "unknown_identifier"
+	CodeNotExact          = "not_exact"
+	CodeInvalidName       = "invalid_name"
+	CodeRedefinition      = "redefinition"
+	CodeRecursion         = "recursion"
+	CodeNotDifferentiable = "not_differentiable"
+	CodeUnknownUnit       = "unknown_unit"
+	CodeDimensionMismatch = "dimension_mismatch"
+	CodeShapeMismatch     = "shape_mismatch"
+	CodeNotInteger        = "not_integer"
+	CodeInvalidFactorial  = "invalid_factorial"
+	CodeTooLarge          = "too_large"
+)
+
+// Error describes why an expression is incorrect and where, Pos is the offset of the character in the expression.
+type Error struct {
+	Code string
+	Pos  int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+func errorf(code string, pos int, format string, args ...any) *Error {
+	return &Error{Code: code, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
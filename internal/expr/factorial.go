@@ -0,0 +1,20 @@
+package expr
+
+import "math"
+
+// MaxFactorial is the largest argument of the factorial, 10000! has 35660 digits.
+const MaxFactorial = 10000
+
+// CheckFactorial checks that the number can be an argument of the factorial:
+// a non-negative integer without a unit that is not larger than MaxFactorial.
+func CheckFactorial(num *Number) error {
+	switch {
+	case num.Imag || num.Unit != "" || num.Value != math.Trunc(num.Value):
+		return errorf(CodeInvalidFactorial, num.Position, "factorial of '%s' is not defined, an integer is expected", String(num))
+	case num.Value < 0:
+		return errorf(CodeInvalidFactorial, num.Position, "factorial of negative number '%s' is not defined", String(num))
+	case num.Value > MaxFactorial:
+		return errorf(CodeInvalidFactorial, num.Position, "factorial of '%s' is too large, the maximum is %d", String(num), MaxFactorial)
+	}
+	return nil
+}
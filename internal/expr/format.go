@@ -0,0 +1,239 @@
+package expr
+
+import (
+	"slices"
+	"strings"
+)
+
+// Precedence levels of the grammar, an operand of a lower level than its operator needs brackets.
+const (
+	levelConversion = iota
+	levelOr
+	levelAnd
+	levelNot
+	levelBitOr
+	levelBitAnd
+	levelCompare
+	levelShift
+	levelSum
+	levelTerm
+	levelUnary
+	levelPower
+	levelPostfix
+	levelAtom
+)
+
+// Format prints the tree in the canonical form: with the brackets that the grammar needs
+// and nothing more, with spaces around binary operators except ^ and after commas,
+// for example 2 * (3 + x^2) - max(1, y). The canonical form parses back into the same tree.
+func Format(n Node) string {
+	var sb strings.Builder
+	format(&sb, n, levelConversion)
+	return sb.String()
+}
+
+// FormatScript prints the statements of a script in the canonical form separated by "; ".
+func FormatScript(stmts []Statement) string {
+	parts := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		parts[i] = Format(stmt.X)
+		if stmt.Name != "" {
+			parts[i] = stmt.Name + " = " + parts[i]
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// format prints the node, in brackets if its level is lower than the level the context requires.
+func format(sb *strings.Builder, n Node, min int) {
+	if level(n) < min {
+		sb.WriteByte('(')
+		defer sb.WriteByte(')')
+	}
+	switch n := n.(type) {
+	case *Number:
+		sb.WriteString(n.Text)
+		if n.Unit != "" {
+			sb.WriteString(" " + n.Unit)
+		}
+	case *Ident:
+		sb.WriteString(n.Name)
+	case *Unary:
+		switch {
+		case slices.Contains(Postfix, n.Op):
+			format(sb, n.X, levelPostfix)
+			sb.WriteString(n.Op)
+		case n.Op == "not":
+			sb.WriteString("not ")
+			format(sb, n.X, levelNot)
+		default:
+			sb.WriteString(n.Op)
+			format(sb, n.X, levelUnary)
+		}
+	case *Binary:
+		if n.Op == Conversion {
+			format(sb, n.X, levelOr)
+			sb.WriteString(" " + Conversion + " " + n.Y.(*Number).Unit)
+			return
+		}
+		left, right := operands(n)
+		format(sb, n.X, left)
+		if n.Op == "^" {
+			sb.WriteString(n.Op)
+		} else {
+			sb.WriteString(" " + n.Op + " ")
+		}
+		format(sb, n.Y, right)
+	case *Call:
+		sb.WriteString(n.Func + "(")
+		for i, arg := range n.Args {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			format(sb, arg, levelOr)
+		}
+		sb.WriteByte(')')
+	case *Array:
+		sb.WriteByte('[')
+		for i, elem := range n.Elems {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			format(sb, elem, levelOr)
+		}
+		sb.WriteByte(']')
+	}
+}
+
+// level returns the precedence level of the operator at the root of the tree.
+func level(n Node) int {
+	switch n := n.(type) {
+	case *Unary:
+		switch {
+		case slices.Contains(Postfix, n.Op):
+			return levelPostfix
+		case n.Op == "not":
+			return levelNot
+		}
+		return levelUnary
+	case *Binary:
+		switch {
+		case n.Op == Conversion:
+			return levelConversion
+		case n.Op == "or":
+			return levelOr
+		case n.Op == "and":
+			return levelAnd
+		case n.Op == "|":
+			return levelBitOr
+		case n.Op == "&":
+			return levelBitAnd
+		case slices.Contains(Comparisons, n.Op):
+			return levelCompare
+		case n.Op == "<<" || n.Op == ">>":
+			return levelShift
+		case n.Op == "+" || n.Op == "-":
+			return levelSum
+		case n.Op == "^":
+			return levelPower
+		}
+		return levelTerm
+	case *Number:
+		// a negative number left by Simplify is read back as the minus of a number
+		if strings.HasPrefix(n.Text, "-") {
+			return levelUnary
+		}
+	}
+	return levelAtom
+}
+
+// operands returns the levels that the operands of the binary operator require.
+func operands(n *Binary) (int, int) {
+	l := level(n)
+	left, right := l, l+1
+	switch {
+	case n.Op == "^":
+		left, right = levelPostfix, levelUnary
+	case l == levelCompare:
+		left = l + 1
+	}
+	// a quantity before ^ or before a name of a unit would take the operator into its unit,
+	// also when it ends the left operand, as in (-3 m^3) * m
+	if num, ok := rightmost(n.X).(*Number); ok && num.Unit != "" && (n.Op == "^" || isUnitName(leftmost(n.Y))) {
+		left = levelAtom + 1
+	}
+	// a sign after % would make it the percent
+	if n.Op == "%" && startsWithSign(n.Y) {
+		right = levelAtom + 1
+	}
+	return left, right
+}
+
+// leftmost returns the node whose text is printed first, it is nil when the text starts with a bracket.
+func leftmost(n Node) Node {
+	switch x := n.(type) {
+	case *Binary:
+		if x.Op == Conversion {
+			return leftmost(x.X)
+		}
+		if left, _ := operands(x); level(x.X) < left {
+			return nil
+		}
+		return leftmost(x.X)
+	case *Unary:
+		if !slices.Contains(Postfix, x.Op) {
+			return n
+		}
+		if level(x.X) < levelPostfix {
+			return nil
+		}
+		return leftmost(x.X)
+	}
+	return n
+}
+
+// rightmost returns the node whose text is printed last, it is nil when the text ends with a bracket.
+func rightmost(n Node) Node {
+	switch x := n.(type) {
+	case *Binary:
+		if x.Op == Conversion {
+			return x.Y
+		}
+		if _, right := operands(x); level(x.Y) < right {
+			return nil
+		}
+		return rightmost(x.Y)
+	case *Unary:
+		if slices.Contains(Postfix, x.Op) {
+			return n
+		}
+		min := levelUnary
+		if x.Op == "not" {
+			min = levelNot
+		}
+		if level(x.X) < min {
+			return nil
+		}
+		return rightmost(x.X)
+	}
+	return n
+}
+
+func startsWithSign(n Node) bool {
+	switch x := leftmost(n).(type) {
+	case *Unary:
+		return true
+	case *Number:
+		return strings.HasPrefix(x.Text, "-")
+	}
+	return false
+}
+
+func isUnitName(n Node) bool {
+	id, ok := n.(*Ident)
+	if !ok {
+		return false
+	}
+	_, ok = Units[id.Name]
+	return ok
+}
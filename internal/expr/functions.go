@@ -0,0 +1,30 @@
+package expr
+
+// Function describes a built-in function of expressions.
+type Function struct {
+	// MinArgs and MaxArgs limit the number of arguments, MaxArgs is -1 for variadic functions.
+	MinArgs, MaxArgs int
+	// Cost is the simulated time of computing in units of TIME_FUNCTIONS_MS.
+	Cost int
+	// Exact reports whether the function can be computed in the exact mode.
+	Exact bool
+}
+
+// Functions is the registry of built-in functions. Variadic functions are computed as a chain
+// of tasks with two arguments, so they must be associative. The branches of if are computed
+// only after the condition, and only the chosen one.
+var Functions = map[string]Function{
+	"sqrt":  {MinArgs: 1, MaxArgs: 1, Cost: 2},
+	"abs":   {MinArgs: 1, MaxArgs: 1, Cost: 1, Exact: true},
+	"round": {MinArgs: 1, MaxArgs: 1, Cost: 1, Exact: true},
+	"log":   {MinArgs: 1, MaxArgs: 1, Cost: 3},
+	"sin":   {MinArgs: 1, MaxArgs: 1, Cost: 3},
+	"cos":   {MinArgs: 1, MaxArgs: 1, Cost: 3},
+	"min":   {MinArgs: 1, MaxArgs: -1, Cost: 1, Exact: true},
+	"max":   {MinArgs: 1, MaxArgs: -1, Cost: 1, Exact: true},
+	"if":    {MinArgs: 3, MaxArgs: 3, Cost: 1, Exact: true},
+	// the functions of vectors and matrices are split into arithmetic tasks
+	"dot":       {MinArgs: 2, MaxArgs: 2, Exact: true},
+	"transpose": {MinArgs: 1, MaxArgs: 1, Exact: true},
+	"det":       {MinArgs: 1, MaxArgs: 1, Exact: true},
+}
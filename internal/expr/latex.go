@@ -0,0 +1,303 @@
+package expr
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// latexOperators are the LaTeX commands of binary operators, the others are written as they are.
+var latexOperators = map[string]string{
+	"*":   `\cdot`,
+	"%":   `\bmod`,
+	"==":  "=",
+	"!=":  `\neq`,
+	"<=":  `\leq`,
+	">=":  `\geq`,
+	"and": `\land`,
+	"or":  `\lor`,
+	"&":   `\mathbin{\&}`,
+	"|":   `\mathbin{|}`,
+	"<<":  `\ll`,
+	">>":  `\gg`,
+}
+
+// latexFunctions are the built-in functions that LaTeX has commands for.
+var latexFunctions = map[string]string{
+	"log": `\ln`,
+	"sin": `\sin`,
+	"cos": `\cos`,
+	"min": `\min`,
+	"max": `\max`,
+	"det": `\det`,
+}
+
+// LaTeX renders the tree as a LaTeX formula for MathJax, for example (1+2)/3 becomes \frac{1 + 2}{3}.
+// Fractions, roots and powers delimit their operands themselves, so they need fewer brackets
+// than the canonical form.
+func LaTeX(n Node) string {
+	var sb strings.Builder
+	latex(&sb, n, levelConversion)
+	return sb.String()
+}
+
+// LaTeXScript renders the statements of a script separated by ";\quad".
+func LaTeXScript(stmts []Statement) string {
+	parts := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		parts[i] = LaTeX(stmt.X)
+		if stmt.Name != "" {
+			parts[i] = latexName(stmt.Name) + " = " + parts[i]
+		}
+	}
+	return strings.Join(parts, `;\quad `)
+}
+
+// latex renders the node, in brackets if its level is lower than the level the context requires.
+func latex(sb *strings.Builder, n Node, min int) {
+	if latexLevel(n) < min {
+		sb.WriteString(`\left(`)
+		defer sb.WriteString(`\right)`)
+	}
+	switch n := n.(type) {
+	case *Number:
+		sb.WriteString(latexNumber(n.Text))
+		if n.Unit != "" {
+			sb.WriteString(`\,` + latexUnit(n.Unit))
+		}
+	case *Ident:
+		sb.WriteString(latexName(n.Name))
+	case *Unary:
+		switch {
+		case n.Op == "!":
+			latex(sb, n.X, levelPostfix)
+			sb.WriteString("!")
+		case n.Op == "%":
+			latex(sb, n.X, levelPostfix)
+			sb.WriteString(`\%`)
+		case n.Op == "not":
+			// the precedence of not is lower than in logic notation, so its operand is bracketed
+			sb.WriteString(`\lnot `)
+			latex(sb, n.X, levelUnary)
+		default:
+			sb.WriteString(n.Op)
+			operand(sb, n.X, levelUnary)
+		}
+	case *Binary:
+		switch n.Op {
+		case Conversion:
+			latex(sb, n.X, levelOr)
+			sb.WriteString(` \to ` + latexUnit(n.Y.(*Number).Unit))
+		case "/":
+			sb.WriteString(`\frac{` + LaTeX(n.X) + "}{" + LaTeX(n.Y) + "}")
+		case "//":
+			sb.WriteString(`\left\lfloor \frac{` + LaTeX(n.X) + "}{" + LaTeX(n.Y) + `} \right\rfloor`)
+		case "^":
+			latex(sb, n.X, levelPostfix)
+			sb.WriteString("^{" + LaTeX(n.Y) + "}")
+		default:
+			l := latexLevel(n)
+			left, right := l, l+1
+			if l == levelCompare {
+				left = l + 1
+			}
+			latex(sb, n.X, left)
+			op, ok := latexOperators[n.Op]
+			if !ok {
+				op = n.Op
+			}
+			sb.WriteString(" " + op + " ")
+			operand(sb, n.Y, right)
+		}
+	case *Call:
+		latexCall(sb, n)
+	case *Array:
+		sb.WriteString(`\begin{pmatrix} ` + latexRows(n) + ` \end{pmatrix}`)
+	}
+}
+
+// operand renders the operand after an operator, a sign at its start would follow the operator
+// without a space, so the operand gets brackets.
+func operand(sb *strings.Builder, n Node, min int) {
+	var op strings.Builder
+	latex(&op, n, min)
+	s := op.String()
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		s = `\left(` + s + `\right)`
+	}
+	sb.WriteString(s)
+}
+
+func latexCall(sb *strings.Builder, n *Call) {
+	switch n.Func {
+	case "sqrt":
+		sb.WriteString(`\sqrt{` + LaTeX(n.Args[0]) + "}")
+		return
+	case "abs":
+		sb.WriteString(`\left|` + LaTeX(n.Args[0]) + `\right|`)
+		return
+	case "if":
+		sb.WriteString(`\begin{cases} ` + LaTeX(n.Args[1]) + ` & \text{if } ` + LaTeX(n.Args[0]) +
+			` \\ ` + LaTeX(n.Args[2]) + ` & \text{otherwise} \end{cases}`)
+		return
+	case "transpose":
+		latex(sb, n.Args[0], levelPostfix)
+		sb.WriteString(`^{\mathsf{T}}`)
+		return
+	case "dot":
+		latex(sb, n.Args[0], levelUnary)
+		sb.WriteString(` \cdot `)
+		operand(sb, n.Args[1], levelUnary)
+		return
+	}
+	if arr, ok := n.Args[0].(*Array); ok && n.Func == "det" {
+		sb.WriteString(`\begin{vmatrix} ` + latexRows(arr) + ` \end{vmatrix}`)
+		return
+	}
+
+	name, ok := latexFunctions[n.Func]
+	switch {
+	case ok:
+	case len(n.Func) == 1:
+		name = n.Func
+	default:
+		name = `\operatorname{` + escape(n.Func) + "}"
+	}
+	sb.WriteString(name + `\left(`)
+	for i, arg := range n.Args {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		latex(sb, arg, levelOr)
+	}
+	sb.WriteString(`\right)`)
+}
+
+// latexRows renders the elements of a vector as a row and the rows of a matrix separated by \\.
+func latexRows(n *Array) string {
+	matrix := len(n.Elems) > 0
+	for _, elem := range n.Elems {
+		if _, ok := elem.(*Array); !ok {
+			matrix = false
+		}
+	}
+	if !matrix {
+		elems := make([]string, len(n.Elems))
+		for i, elem := range n.Elems {
+			elems[i] = LaTeX(elem)
+		}
+		return strings.Join(elems, " & ")
+	}
+	rows := make([]string, len(n.Elems))
+	for i, row := range n.Elems {
+		rows[i] = latexRows(row.(*Array))
+	}
+	return strings.Join(rows, ` \\ `)
+}
+
+// latexLevel is the level of the node in LaTeX: fractions and quotients delimit their operands,
+// while a negative number or a quantity needs brackets before ^ like a unary operation.
+func latexLevel(n Node) int {
+	switch n := n.(type) {
+	case *Number:
+		if strings.HasPrefix(n.Text, "-") || n.Unit != "" {
+			return levelUnary
+		}
+	case *Binary:
+		switch n.Op {
+		case "/":
+			return levelUnary
+		case "//":
+			return levelAtom
+		}
+	case *Call:
+		if n.Func == "dot" {
+			return levelTerm
+		}
+		if n.Func == "transpose" {
+			return levelPower
+		}
+	}
+	return level(n)
+}
+
+// latexNumber renders a number literal, the exponent is written as a power of 10
+// and integers with a prefix are written in a monospaced font, for example \mathtt{0xFF}.
+func latexNumber(text string) string {
+	sign := ""
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		sign, text = text[:1], text[1:]
+	}
+	if sign == "+" {
+		sign = ""
+	}
+	switch {
+	case text == "Inf":
+		return sign + `\infty`
+	case text == "NaN":
+		return `\mathrm{NaN}`
+	case len(text) > 1 && text[0] == '0' && strings.ContainsRune("xXbBoO", rune(text[1])):
+		return sign + `\mathtt{` + text + "}"
+	}
+
+	text, imag := strings.CutSuffix(text, Imaginary)
+	if mantissa, exp, ok := strings.Cut(strings.ToLower(text), "e"); ok {
+		if e, err := strconv.Atoi(exp); err == nil {
+			text = mantissa + ` \cdot 10^{` + strconv.Itoa(e) + "}"
+		}
+	}
+	if imag {
+		text += Imaginary
+	}
+	return sign + text
+}
+
+// latexUnit renders a product of units, for example km/h becomes \mathrm{km}/\mathrm{h}.
+func latexUnit(unit string) string {
+	var sb strings.Builder
+	for unit != "" {
+		i := strings.IndexAny(unit, "*/")
+		if i < 0 {
+			i = len(unit)
+		}
+		name, power, ok := strings.Cut(unit[:i], "^")
+		if name == "1" {
+			sb.WriteString(name)
+		} else {
+			sb.WriteString(`\mathrm{` + name + "}")
+		}
+		if ok {
+			sb.WriteString("^{" + power + "}")
+		}
+		if i == len(unit) {
+			break
+		}
+		if unit[i] == '*' {
+			sb.WriteString(` \cdot `)
+		} else {
+			sb.WriteString("/")
+		}
+		unit = unit[i+1:]
+	}
+	return sb.String()
+}
+
+// latexName renders a name: pi is the Greek letter, a letter followed by digits gets
+// a subscript, for example x_{1}, and longer names are written upright.
+func latexName(name string) string {
+	if name == "pi" {
+		return `\pi`
+	}
+	if i := strings.IndexFunc(name, unicode.IsDigit); i == 1 && !slices.ContainsFunc([]rune(name[1:]), func(r rune) bool { return !unicode.IsDigit(r) }) {
+		return name[:1] + "_{" + name[1:] + "}"
+	}
+	if len(name) == 1 {
+		return name
+	}
+	return `\mathrm{` + escape(name) + "}"
+}
+
+func escape(name string) string {
+	return strings.ReplaceAll(name, "_", `\_`)
+}
@@ -0,0 +1,146 @@
+package expr
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+type kind int
+
+const (
+	eof kind = iota
+	number
+	operator
+	ident
+	lparen
+	rparen
+	comma
+	assign
+	semicolon
+	lbracket
+	rbracket
+)
+
+type token struct {
+	kind kind
+	text string
+	pos  int
+}
+
+const operators = "+-*/^%&|!"
+
+// Comparisons are the operators that compare two numbers, their result is 1 when true and 0 otherwise.
+var Comparisons = []string{"<", "<=", ">", ">=", "==", "!="}
+
+// Bitwise are the operators on the bits of integers, shifts are written as << and >>.
+var Bitwise = []string{"&", "|", "<<", ">>"}
+
+// Postfix are the operators written after the operand: the factorial and the percent, 15% is 0.15.
+var Postfix = []string{"!", "%"}
+
+// Keywords are the logical operators written as words, they can't be used as names.
+var Keywords = []string{"and", "or", "not"}
+
+// lex splits the source into tokens, spaces between tokens are skipped.
+// Positions of tokens are offsets of characters, not bytes.
+func lex(src string) ([]token, error) {
+	runes := []rune(src)
+	var tokens []token
+	for i := 0; i < len(runes); {
+		ch := runes[i]
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '0' && i+1 < len(runes) && strings.ContainsRune("xXbBoO", runes[i+1]):
+			// an integer with the prefix of its base, for example 0xFF, the digits are checked by the parser
+			start := i
+			for i += 2; i < len(runes) && isNameRune(runes[i]); i++ {
+			}
+			tokens = append(tokens, token{kind: number, text: string(runes[start:i]), pos: start})
+		case isDigit(ch) || ch == '.':
+			start := i
+			i = scanNumber(runes, i)
+			// a number directly followed by i is an imaginary literal, for example 2i
+			if i < len(runes) && runes[i] == 'i' && (i+1 == len(runes) || !isNameRune(runes[i+1])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: number, text: string(runes[start:i]), pos: start})
+		case (ch == '*' || ch == '/' || ch == '<' || ch == '>') && i+1 < len(runes) && runes[i+1] == ch:
+			tokens = append(tokens, token{kind: operator, text: string(runes[i : i+2]), pos: i})
+			i += 2
+		case (ch == '<' || ch == '>' || ch == '=' || ch == '!') && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, token{kind: operator, text: string(runes[i : i+2]), pos: i})
+			i += 2
+		case ch == '<' || ch == '>':
+			tokens = append(tokens, token{kind: operator, text: string(ch), pos: i})
+			i++
+		case strings.ContainsRune(operators, ch):
+			tokens = append(tokens, token{kind: operator, text: string(ch), pos: i})
+			i++
+		case unicode.IsLetter(ch) || ch == '_':
+			start := i
+			for i < len(runes) && isNameRune(runes[i]) {
+				i++
+			}
+			k := ident
+			if slices.Contains(Keywords, string(runes[start:i])) {
+				k = operator
+			}
+			tokens = append(tokens, token{kind: k, text: string(runes[start:i]), pos: start})
+		case ch == '=':
+			tokens = append(tokens, token{kind: assign, text: "=", pos: i})
+			i++
+		case ch == ';':
+			tokens = append(tokens, token{kind: semicolon, text: ";", pos: i})
+			i++
+		case ch == ',':
+			tokens = append(tokens, token{kind: comma, text: ",", pos: i})
+			i++
+		case ch == '(':
+			tokens = append(tokens, token{kind: lparen, text: "(", pos: i})
+			i++
+		case ch == '[':
+			tokens = append(tokens, token{kind: lbracket, text: "[", pos: i})
+			i++
+		case ch == ']':
+			tokens = append(tokens, token{kind: rbracket, text: "]", pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, token{kind: rparen, text: ")", pos: i})
+			i++
+		default:
+			return nil, errorf(CodeInvalidSymbol, i, "invalid symbol '%c'", ch)
+		}
+	}
+	return append(tokens, token{kind: eof, pos: len(runes)}), nil
+}
+
+// scanNumber returns the end of the number literal that starts at i,
+// for example 12, 2.5, .5 or 1e-3.
+func scanNumber(src []rune, i int) int {
+	for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+		i++
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && isDigit(src[j]) {
+			for j < len(src) && isDigit(src[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
+
+func isDigit(ch rune) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isNameRune(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
+}
@@ -0,0 +1,439 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Options change the grammar accepted by ParseWith.
+type Options struct {
+	// ImplicitMultiplication allows to omit * before a bracket or a name, for example 2(3+4) or 3pi.
+	ImplicitMultiplication bool
+	// Functions are the user-defined functions that can be called besides the built-in ones.
+	Functions map[string]*Definition
+}
+
+// Parse builds the syntax tree of an arithmetic expression with the default options.
+// Errors of the expression are returned as *Error.
+//
+// Grammar:
+//
+//	stmt    = expr [ "to" unit ]
+//	expr    = and { "or" and }
+//	and     = not { "and" not }
+//	not     = "not" not | bitor
+//	bitor   = bitand { "|" bitand }
+//	bitand  = compare { "&" compare }
+//	compare = shift [ ("<" | "<=" | ">" | ">=" | "==" | "!=") shift ]
+//	shift   = sum { ("<<" | ">>") sum }
+//	sum     = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%" | "//") unary }
+//	unary   = ("+" | "-") unary | power
+//	power   = postfix [ ("^" | "**") unary ]
+//	postfix = factor { "!" | "%" }
+//	factor  = number [ unit ] | ident | call | "(" expr ")" | array
+//	number  = decimal | "0x" hex | "0b" binary | "0o" octal
+//	array   = "[" expr { "," expr } "]"
+//	call    = ident "(" expr { "," expr } ")"
+//
+// A call of a user-defined function from the options is kept in the tree, Inline replaces it with the body.
+// % after an operand is the percent when no operand follows it: at the end, before a closing bracket
+// or before any operator except not, a sign is read as the operator, so 200*15% is 30, 200*15%-1 is 29
+// and 50% * 2 is 1, 7%(-3) is the remainder. A literal argument of the factorial
+// must be a non-negative integer up to MaxFactorial, -3! is -(3!).
+// The bitwise operators have the precedence of C, so x & 1 == 1 is x & (1 == 1), their literal
+// operands must be integers.
+//
+// With implicit multiplication a unary without an operator is also allowed in term
+// when it starts with a name or a bracket.
+func Parse(src string) (Node, error) {
+	return ParseWith(src, Options{})
+}
+
+// ParseWith is the same as Parse with the given options.
+func ParseWith(src string, opts Options) (Node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, opts: opts}
+	n, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != eof {
+		return nil, unexpected(tok)
+	}
+	return n, nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	opts   Options
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.i]
+	if tok.kind != eof {
+		p.i++
+	}
+	return tok
+}
+
+// statement is an expression that can be converted to a unit at the end, for example 3 ft to m.
+// The unit of the conversion is kept as the quantity 1 unit in Y of the Binary node.
+func (p *parser) statement() (Node, error) {
+	x, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if tok.kind != ident || tok.text != Conversion {
+		return x, nil
+	}
+	p.next()
+	start := p.peek().pos
+	text, _, err := p.unit()
+	if err != nil {
+		return nil, err
+	}
+	return &Binary{Op: Conversion, X: x, Y: &Number{Value: 1, Text: "1", Unit: text, Position: start}, Position: tok.pos}, nil
+}
+
+func (p *parser) expr() (Node, error) {
+	return p.binary(p.and, "or")
+}
+
+func (p *parser) and() (Node, error) {
+	return p.binary(p.not, "and")
+}
+
+func (p *parser) not() (Node, error) {
+	tok := p.peek()
+	if tok.kind != operator || tok.text != "not" {
+		return p.bitor()
+	}
+	p.next()
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	return &Unary{Op: tok.text, X: x, Position: tok.pos}, nil
+}
+
+func (p *parser) bitor() (Node, error) {
+	return p.bitwise(p.bitand, "|")
+}
+
+func (p *parser) bitand() (Node, error) {
+	return p.bitwise(p.compare, "&")
+}
+
+// compare is not associative, 1<2<3 is an error.
+func (p *parser) compare() (Node, error) {
+	x, err := p.shift()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if tok.kind != operator || !slices.Contains(Comparisons, tok.text) {
+		return x, nil
+	}
+	p.next()
+	y, err := p.shift()
+	if err != nil {
+		return nil, err
+	}
+	return &Binary{Op: tok.text, X: x, Y: y, Position: tok.pos}, nil
+}
+
+func (p *parser) shift() (Node, error) {
+	return p.bitwise(p.sum, "<<", ">>")
+}
+
+func (p *parser) sum() (Node, error) {
+	return p.binary(p.term, "+", "-")
+}
+
+func (p *parser) term() (Node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op := tok.text
+		switch {
+		case tok.kind == operator && slices.Contains([]string{"*", "/", "%", "//"}, tok.text):
+			p.next()
+		case p.opts.ImplicitMultiplication && ((tok.kind == ident && tok.text != Conversion) || tok.kind == lparen):
+			// the operator is omitted, the multiplication is placed before the next operand
+			op = "*"
+		default:
+			return x, nil
+		}
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = &Binary{Op: op, X: x, Y: y, Position: tok.pos}
+	}
+}
+
+// unary applies signs to any operand, for example -(2+3). The sign binds looser than
+// the power and the factorial also before a number, so -2^2 is -(2^2).
+func (p *parser) unary() (Node, error) {
+	tok := p.peek()
+	if tok.kind != operator || (tok.text != "+" && tok.text != "-") {
+		return p.power()
+	}
+	p.next()
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &Unary{Op: tok.text, X: x, Position: tok.pos}, nil
+}
+
+// power is right-associative: 2^3^2 is 2^(3^2). The ** operator is an alias of ^.
+func (p *parser) power() (Node, error) {
+	x, err := p.postfix()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if tok.kind != operator || (tok.text != "^" && tok.text != "**") {
+		return x, nil
+	}
+	p.next()
+	y, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &Binary{Op: "^", X: x, Y: y, Position: tok.pos}, nil
+}
+
+// postfix applies the factorial and the percent to the operand, 3!! is (3!)!.
+func (p *parser) postfix() (Node, error) {
+	x, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != operator || !slices.Contains(Postfix, tok.text) || (tok.text == "%" && !p.isPercent()) {
+			return x, nil
+		}
+		p.next()
+		if num, ok := x.(*Number); ok && tok.text == "!" {
+			if err := CheckFactorial(num); err != nil {
+				return nil, err
+			}
+		}
+		x = &Unary{Op: tok.text, X: x, Position: tok.pos}
+	}
+}
+
+// isPercent reports whether % at the current token is the percent, that is no operand follows it.
+func (p *parser) isPercent() bool {
+	next := p.tokens[p.i+1]
+	switch next.kind {
+	case eof, rparen, rbracket, comma, semicolon:
+		return true
+	case ident:
+		return next.text == Conversion
+	case operator:
+		return next.text != "not"
+	}
+	return false
+}
+
+// binary parses a left-associative chain of operands joined by the given operators.
+func (p *parser) binary(operand func() (Node, error), ops ...string) (Node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != operator || !slices.Contains(ops, tok.text) {
+			return x, nil
+		}
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &Binary{Op: tok.text, X: x, Y: y, Position: tok.pos}
+	}
+}
+
+// bitwise is binary for the bitwise operators, a literal operand must be an integer.
+func (p *parser) bitwise(operand func() (Node, error), ops ...string) (Node, error) {
+	n, err := p.binary(operand, ops...)
+	if err != nil {
+		return nil, err
+	}
+	for b, ok := n.(*Binary); ok && slices.Contains(ops, b.Op); b, ok = b.X.(*Binary) {
+		for _, x := range []Node{b.X, b.Y} {
+			if num, ok := x.(*Number); ok && (num.Imag || num.Unit != "" || num.Value != math.Trunc(num.Value)) {
+				return nil, errorf(CodeNotInteger, num.Position, "operator '%s' expects integers, got '%s'", b.Op, String(num))
+			}
+		}
+	}
+	return n, nil
+}
+
+func (p *parser) factor() (Node, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == number:
+		return p.quantity(tok.text, tok.pos)
+	case tok.kind == ident && p.peek().kind == lparen && (!p.opts.ImplicitMultiplication || p.isFunction(tok.text)):
+		return p.call(tok)
+	case tok.kind == ident:
+		return &Ident{Name: tok.text, Position: tok.pos}, nil
+	case tok.kind == lparen:
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.closing(tok); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case tok.kind == lbracket:
+		var elems []Node
+		for {
+			elem, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+			if p.peek().kind != comma {
+				break
+			}
+			p.next()
+		}
+		if end := p.next(); end.kind != rbracket {
+			if end.kind == eof {
+				return nil, errorf(CodeBracketMismatch, tok.pos, "bracket '[' is not closed")
+			}
+			return nil, unexpected(end)
+		}
+		return &Array{Elems: elems, Position: tok.pos}, nil
+	}
+	return nil, unexpected(tok)
+}
+
+func (p *parser) call(name token) (Node, error) {
+	fn, ok := Functions[name.text]
+	def, defined := p.opts.Functions[name.text]
+	if !ok && !defined {
+		return nil, errorf(CodeUnknownFunction, name.pos, "unknown function '%s'", name.text)
+	}
+	open := p.next()
+	if open.kind != lparen {
+		return nil, unexpected(open)
+	}
+	var args []Node
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().kind != comma {
+			break
+		}
+		p.next()
+	}
+	if err := p.closing(open); err != nil {
+		return nil, err
+	}
+	if !ok && len(args) != len(def.Params) {
+		return nil, errorf(CodeInvalidArity, name.pos, "function '%s' expects %d argument(s), got %d", name.text, len(def.Params), len(args))
+	}
+	if ok && (len(args) < fn.MinArgs || (fn.MaxArgs >= 0 && len(args) > fn.MaxArgs)) {
+		return nil, errorf(CodeInvalidArity, name.pos, "function '%s' expects %s, got %d", name.text, arity(fn), len(args))
+	}
+	return &Call{Func: name.text, Args: args, Position: name.pos}, nil
+}
+
+// closing consumes the bracket that closes the open one.
+func (p *parser) closing(open token) error {
+	tok := p.next()
+	if tok.kind == rparen {
+		return nil
+	}
+	if tok.kind == eof {
+		return errorf(CodeBracketMismatch, open.pos, "bracket '(' is not closed")
+	}
+	return unexpected(tok)
+}
+
+func (p *parser) isFunction(name string) bool {
+	_, ok := Functions[name]
+	_, defined := p.opts.Functions[name]
+	return ok || defined
+}
+
+func arity(fn Function) string {
+	switch {
+	case fn.MaxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", fn.MinArgs)
+	case fn.MinArgs == fn.MaxArgs:
+		return fmt.Sprintf("%d argument(s)", fn.MinArgs)
+	}
+	return fmt.Sprintf("from %d to %d arguments", fn.MinArgs, fn.MaxArgs)
+}
+
+// quantity is a number literal with an optional unit, for example 5 km.
+// A unit after a number takes precedence over implicit multiplication by a variable.
+func (p *parser) quantity(text string, pos int) (Node, error) {
+	n, err := newNumber(text, pos)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isUnit() {
+		return n, nil
+	}
+	if n.Unit, _, err = p.unit(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func newNumber(text string, pos int) (*Number, error) {
+	if digits := strings.TrimPrefix(text, "-"); len(digits) > 1 && strings.ContainsRune("xXbBoO", rune(digits[1])) {
+		v, err := strconv.ParseInt(text, 0, 64)
+		if err != nil || strings.Contains(text, "_") {
+			return nil, errorf(CodeInvalidNumber, pos, "invalid number '%s'", text)
+		}
+		return &Number{Value: float64(v), Text: text, Position: pos}, nil
+	}
+	value, imag := strings.CutSuffix(text, Imaginary)
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, errorf(CodeInvalidNumber, pos, "invalid number '%s'", text)
+	}
+	return &Number{Value: v, Imag: imag, Text: text, Position: pos}, nil
+}
+
+func unexpected(tok token) error {
+	switch tok.kind {
+	case eof:
+		return errorf(CodeUnexpectedEnd, tok.pos, "unexpected end of expression")
+	case rparen, rbracket:
+		return errorf(CodeBracketMismatch, tok.pos, "unexpected '%s'", tok.text)
+	}
+	return errorf(CodeUnexpectedToken, tok.pos, "unexpected '%s'", tok.text)
+}
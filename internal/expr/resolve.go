@@ -0,0 +1,107 @@
+package expr
+
+import (
+	"math"
+	"strconv"
+)
+
+// Constants are the built-in names of expressions, they can't be used as names of variables.
+var Constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// Imaginary is the name of the imaginary unit, it can also follow a number literal, for example 2i.
+const Imaginary = "i"
+
+// IsName reports whether s can be a name of a variable.
+func IsName(s string) bool {
+	tokens, err := lex(s)
+	if err != nil || len(tokens) != 2 || tokens[0].kind != ident || tokens[0].text != s {
+		return false
+	}
+	_, isConst := Constants[s]
+	_, isFunc := Functions[s]
+	return !isConst && !isFunc && s != Imaginary && s != Conversion
+}
+
+// Resolve returns a copy of the tree where every identifier is replaced with the number of
+// a constant or of a variable from vars. It also returns the values of the variables that were used.
+func Resolve(n Node, vars map[string]float64) (Node, map[string]float64, error) {
+	used := make(map[string]float64)
+	n, err := resolve(n, vars, used, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return n, used, nil
+}
+
+func resolve(n Node, vars, used map[string]float64, bound map[string]bool) (Node, error) {
+	switch n := n.(type) {
+	case *Ident:
+		if n.Name == Imaginary {
+			return &Number{Value: 1, Imag: true, Text: n.Name, Position: n.Position}, nil
+		}
+		if bound[n.Name] {
+			return n, nil
+		}
+		if v, ok := Constants[n.Name]; ok {
+			return &Number{Value: v, Text: n.Name, Position: n.Position}, nil
+		}
+		v, ok := vars[n.Name]
+		if !ok {
+			return nil, errorf(CodeUnknownIdent, n.Position, "unknown variable '%s'", n.Name)
+		}
+		used[n.Name] = v
+		return &Number{Value: v, Text: strconv.FormatFloat(v, 'g', -1, 64), Position: n.Position}, nil
+	case *Unary:
+		x, err := resolve(n.X, vars, used, bound)
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: n.Op, X: x, Position: n.Position}, nil
+	case *Binary:
+		x, err := resolve(n.X, vars, used, bound)
+		if err != nil {
+			return nil, err
+		}
+		y, err := resolve(n.Y, vars, used, bound)
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: n.Op, X: x, Y: y, Position: n.Position}, nil
+	case *Call:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			a, err := resolve(arg, vars, used, bound)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = a
+		}
+		return &Call{Func: n.Func, Args: args, Position: n.Position}, nil
+	case *Array:
+		elems := make([]Node, len(n.Elems))
+		for i, elem := range n.Elems {
+			e, err := resolve(elem, vars, used, bound)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = e
+		}
+		return &Array{Elems: elems, Position: n.Position}, nil
+	}
+	return n, nil
+}
+
+// IsComplex reports whether the tree contains an imaginary number.
+func IsComplex(n Node) bool {
+	found := false
+	Walk(n, func(n Node) error {
+		if num, ok := n.(*Number); ok && num.Imag {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,80 @@
+package expr
+
+// Statement is a statement of a script: a binding of the value of X to Name
+// or, for the last statement, an expression without a name.
+type Statement struct {
+	Name     string
+	X        Node
+	Position int
+}
+
+// ParseScript builds the statements of a script, for example a = 3*4; b = a+2; a*b.
+// Names bound by earlier statements can be used in later ones.
+//
+// Grammar:
+//
+//	script    = statement { ";" statement } [ ";" ]
+//	statement = [ ident "=" ] stmt
+//
+// Only the last statement can be without a name.
+func ParseScript(src string, opts Options) ([]Statement, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, opts: opts}
+
+	var stmts []Statement
+	for {
+		tok := p.peek()
+		stmt := Statement{Position: tok.pos}
+		if tok.kind == ident && p.tokens[p.i+1].kind == assign {
+			if !IsName(tok.text) {
+				return nil, errorf(CodeInvalidName, tok.pos, "'%s' can't be a name of a binding", tok.text)
+			}
+			stmt.Name = tok.text
+			p.next()
+			p.next()
+		}
+		if stmt.X, err = p.statement(); err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+
+		end := p.next()
+		if end.kind == semicolon && p.peek().kind == eof {
+			end = p.next()
+		}
+		if end.kind == eof {
+			return stmts, nil
+		}
+		if end.kind != semicolon {
+			return nil, unexpected(end)
+		}
+		if stmt.Name == "" {
+			return nil, errorf(CodeUnexpectedToken, end.pos, "only the last statement can be without a name")
+		}
+	}
+}
+
+// ResolveScript resolves the statements as Resolve does, names bound by earlier statements
+// are left as identifiers. It also returns the values of the variables that were used.
+func ResolveScript(stmts []Statement, vars map[string]float64) ([]Statement, map[string]float64, error) {
+	used := make(map[string]float64)
+	bound := make(map[string]bool)
+	resolved := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		x, err := resolve(stmt.X, vars, used, bound)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bound[stmt.Name] {
+			return nil, nil, errorf(CodeRedefinition, stmt.Position, "name '%s' is already bound", stmt.Name)
+		}
+		if stmt.Name != "" {
+			bound[stmt.Name] = true
+		}
+		resolved[i] = Statement{Name: stmt.Name, X: x, Position: stmt.Position}
+	}
+	return resolved, used, nil
+}
@@ -0,0 +1,131 @@
+package expr
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Simplify returns a copy of the tree where identities are folded: x+0, x-0, x*1, x/1 and x^1
+// are x, 0-x is -x, x*0, 0/x and x-x are 0, x^0 is 1 and a double negation is removed. With fold, operations
+// on two real numbers are computed at once, which is only correct for computing in floats.
+// An operand is dropped only if it can't fail or overflow, so x*0 and x-x are folded when x is
+// a number or a name and 0/x when x is a nonzero number, 0/(1-1) is still a division by zero.
+// The identities don't keep the shape of vectors, so trees with arrays must not be simplified.
+func Simplify(n Node, fold bool) Node {
+	return simplify(n, fold, false)
+}
+
+// SimplifySymbolic is Simplify that folds x*0, 0/x and x-x for any x, as in the formula of a derivative,
+// where x/x is 0. An operand that would fail to compute may be dropped, for example 0*log(0) is 0.
+func SimplifySymbolic(n Node, fold bool) Node {
+	return simplify(n, fold, true)
+}
+
+func simplify(n Node, fold, symbolic bool) Node {
+	// drops reports whether the operand can be dropped by an identity
+	drops := func(n Node) bool {
+		switch n.(type) {
+		case *Number, *Ident:
+			return true
+		}
+		return symbolic
+	}
+	switch n := n.(type) {
+	case *Unary:
+		x := simplify(n.X, fold, symbolic)
+		if inner, ok := x.(*Unary); ok && n.Op == "-" && inner.Op == "-" {
+			return inner.X
+		}
+		if n.Op == "+" {
+			return x
+		}
+		if num, ok := x.(*Number); ok && fold && n.Op == "-" && !num.Imag && num.Unit == "" {
+			return literal(-num.Value, n.Position)
+		}
+		return &Unary{Op: n.Op, X: x, Position: n.Position}
+	case *Binary:
+		x, y := simplify(n.X, fold, symbolic), simplify(n.Y, fold, symbolic)
+		switch {
+		case (n.Op == "+" && isValue(x, 0)) || (n.Op == "*" && isValue(x, 1)):
+			return y
+		case (n.Op == "+" || n.Op == "-") && isValue(y, 0), (n.Op == "*" || n.Op == "/") && isValue(y, 1), (n.Op == "^" || n.Op == "**") && isValue(y, 1):
+			return x
+		case n.Op == "-" && isValue(x, 0):
+			return simplify(&Unary{Op: "-", X: y, Position: n.Position}, fold, symbolic)
+		case n.Op == "*" && (isValue(x, 0) && drops(y) || isValue(y, 0) && drops(x)),
+			n.Op == "/" && isValue(x, 0) && (symbolic || isNonzero(y)),
+			n.Op == "-" && String(x) == String(y) && drops(x):
+			return literal(0, n.Position)
+		case (n.Op == "^" || n.Op == "**") && isValue(y, 0):
+			return literal(1, n.Position)
+		}
+		a, aok := x.(*Number)
+		b, bok := y.(*Number)
+		if fold && aok && bok && !a.Imag && !b.Imag && a.Unit == "" && b.Unit == "" {
+			if v, ok := compute(n.Op, a.Value, b.Value); ok {
+				return literal(v, n.Position)
+			}
+		}
+		return &Binary{Op: n.Op, X: x, Y: y, Position: n.Position}
+	case *Call:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = simplify(arg, fold, symbolic)
+		}
+		return &Call{Func: n.Func, Args: args, Position: n.Position}
+	case *Array:
+		elems := make([]Node, len(n.Elems))
+		for i, elem := range n.Elems {
+			elems[i] = simplify(elem, fold, symbolic)
+		}
+		return &Array{Elems: elems, Position: n.Position}
+	}
+	return n
+}
+
+// compute folds an arithmetic operation, the result must be a finite number.
+func compute(op string, x, y float64) (float64, bool) {
+	var v float64
+	switch op {
+	case "+":
+		v = x + y
+	case "-":
+		v = x - y
+	case "*":
+		v = x * y
+	case "/":
+		if y == 0 {
+			return 0, false
+		}
+		v = x / y
+	case "^", "**":
+		v = math.Pow(x, y)
+	default:
+		return 0, false
+	}
+	return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// isValue reports whether the node is the real number v. The text of the literal is
+// compared exactly, so 1.00000000000000000001 is not 1 even if its float is.
+func isValue(n Node, v int64) bool {
+	num, ok := n.(*Number)
+	if !ok || num.Imag || num.Unit != "" {
+		return false
+	}
+	if r, ok := new(big.Rat).SetString(num.Text); ok {
+		return r.Cmp(big.NewRat(v, 1)) == 0
+	}
+	return num.Value == float64(v)
+}
+
+// isNonzero reports whether the node is a number other than zero.
+func isNonzero(n Node) bool {
+	num, ok := n.(*Number)
+	return ok && num.Value != 0
+}
+
+func literal(v float64, pos int) *Number {
+	return &Number{Value: v, Text: strconv.FormatFloat(v, 'g', -1, 64), Position: pos}
+}
@@ -0,0 +1,900 @@
+package expr_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+)
+
+func TestParse(t *testing.T) {
+	testParseCases := []struct {
+		name          string
+		expression    string
+		implicit      bool
+		expectedError bool
+		expectedCode  string
+		expectedPos   int
+		expectedTree  string
+	}{
+		{
+			name:         "parse: precedence",
+			expression:   "1+2-3*4/5",
+			expectedTree: "((1+2)-((3*4)/5))",
+		},
+		{
+			name:         "parse: brackets",
+			expression:   "(1+2)*(3+4)",
+			expectedTree: "((1+2)*(3+4))",
+		},
+		{
+			name:         "parse: negative numbers",
+			expression:   "-1+(-2)",
+			expectedTree: "((-1)+(-2))",
+		},
+		{
+			name:         "parse: minus before power of number",
+			expression:   "-2^2 + (-2)^2",
+			expectedTree: "((-(2^2))+((-2)^2))",
+		},
+		{
+			name:         "parse: spaces",
+			expression:   " 14 + 22 ",
+			expectedTree: "(14+22)",
+		},
+		{
+			name:         "parse: decimal and exponent numbers",
+			expression:   "2.5*1e3/.5E-2",
+			expectedTree: "((2.5*1e3)/.5E-2)",
+		},
+		{
+			name:         "parse: power is right-associative",
+			expression:   "2^3^2",
+			expectedTree: "(2^(3^2))",
+		},
+		{
+			name:         "parse: power precedence",
+			expression:   "2*3**2+1",
+			expectedTree: "((2*(3^2))+1)",
+		},
+		{
+			name:         "parse: modulo and integer division",
+			expression:   "7%3+17//5*2",
+			expectedTree: "((7%3)+((17//5)*2))",
+		},
+		{
+			name:         "parse: functions",
+			expression:   "sqrt(16)+max(3,7,1)*cos(0)",
+			expectedTree: "(sqrt(16)+(max(3,7,1)*cos(0)))",
+		},
+		{
+			name:         "parse: nested functions",
+			expression:   "min(abs(-2), 1+2)",
+			expectedTree: "min(abs((-2)),(1+2))",
+		},
+		{
+			name:         "parse: identifiers",
+			expression:   "2*pi*r",
+			expectedTree: "((2*pi)*r)",
+		},
+		{
+			name:         "parse: imaginary numbers",
+			expression:   "(1+2i)*(3-i)+-1.5i",
+			expectedTree: "(((1+2i)*(3-i))+(-1.5i))",
+		},
+		{
+			name:         "parse: unary minus before brackets",
+			expression:   "-(2+3)*-x",
+			expectedTree: "((-(2+3))*(-x))",
+		},
+		{
+			name:         "parse: unary plus",
+			expression:   "+5-+pi",
+			expectedTree: "((+5)-(+pi))",
+		},
+		{
+			name:         "parse: unary minus in exponent",
+			expression:   "2^-x^2",
+			expectedTree: "(2^(-(x^2)))",
+		},
+		{
+			name:         "parse: implicit multiplication",
+			expression:   "2(3+4)-3pi+2x^2",
+			implicit:     true,
+			expectedTree: "(((2*(3+4))-(3*pi))+(2*(x^2)))",
+		},
+		{
+			name:         "parse: implicit multiplication by a name with brackets",
+			expression:   "pi(2)/sqrt(4)(1)",
+			implicit:     true,
+			expectedTree: "(((pi*2)/sqrt(4))*1)",
+		},
+		{
+			name:         "parse: comparisons and logic",
+			expression:   "1<2 and not x>=3 or y!=0",
+			expectedTree: "(((1<2) and (not (x>=3))) or (y!=0))",
+		},
+		{
+			name:         "parse: conditional",
+			expression:   "if(x > 0 and x <= 10, 1/x, 0)",
+			expectedTree: "if(((x>0) and (x<=10)),(1/x),0)",
+		},
+		{
+			name:         "parse: single number",
+			expression:   "42",
+			expectedTree: "42",
+		},
+		{
+			name:         "parse: prefixed integers",
+			expression:   "0xFF+0b1010-0o17*-0x1f",
+			expectedTree: "((0xFF+0b1010)-(0o17*(-0x1f)))",
+		},
+		{
+			name:         "parse: bitwise precedence",
+			expression:   "1 | 6 & 3 == 3 << 1 + 1",
+			expectedTree: "(1|(6&(3==(3<<(1+1)))))",
+		},
+		{
+			name:         "parse: shifts are left-associative",
+			expression:   "1 << 4 >> 2",
+			expectedTree: "((1<<4)>>2)",
+		},
+		{
+			name:          "parse: bitwise operation on fraction",
+			expression:    "0xF & 1.5",
+			expectedError: true,
+			expectedCode:  expr.CodeNotInteger,
+			expectedPos:   6,
+		},
+		{
+			name:          "parse: invalid binary digit",
+			expression:    "0b102",
+			expectedError: true,
+			expectedCode:  expr.CodeInvalidNumber,
+			expectedPos:   0,
+		},
+		{
+			name:         "parse: factorial",
+			expression:   "-3!+2^3!!",
+			expectedTree: "((-(3!))+(2^((3!)!)))",
+		},
+		{
+			name:         "parse: percent",
+			expression:   "200*15%-1+7%3",
+			expectedTree: "(((200*(15%))-1)+(7%3))",
+		},
+		{
+			name:         "parse: percent before multiplication and power",
+			expression:   "50% * 2 + 50% ^ 2",
+			expectedTree: "(((50%)*2)+((50%)^2))",
+		},
+		{
+			name:          "parse: factorial of fraction",
+			expression:    "1+2.5!",
+			expectedError: true,
+			expectedCode:  expr.CodeInvalidFactorial,
+			expectedPos:   2,
+		},
+		{
+			// the sign of the literal is applied by the planner, it checks the argument of the factorial
+			name:         "parse: factorial of negative number",
+			expression:   "(-3)!",
+			expectedTree: "((-3)!)",
+		},
+		{
+			name:          "parse: two operators",
+			expression:    "16+*2",
+			expectedError: true,
+			expectedCode:  expr.CodeUnexpectedToken,
+			expectedPos:   3,
+		},
+		{
+			name:          "parse: implicit multiplication is off",
+			expression:    "2(3+4)",
+			expectedError: true,
+			expectedCode:  expr.CodeUnexpectedToken,
+			expectedPos:   1,
+		},
+		{
+			name:          "parse: chained comparison",
+			expression:    "1<2<3",
+			expectedError: true,
+			expectedCode:  expr.CodeUnexpectedToken,
+			expectedPos:   3,
+		},
+		{
+			name:          "parse: keyword as operand",
+			expression:    "1+and",
+			expectedError: true,
+			expectedCode:  expr.CodeUnexpectedToken,
+			expectedPos:   2,
+		},
+		{
+			name:          "parse: power without exponent",
+			expression:    "2^",
+			expectedError: true,
+			expectedCode:  expr.CodeUnexpectedEnd,
+			expectedPos:   2,
+		},
+		{
+			name:          "parse: unknown function",
+			expression:    "1+foo(2)",
+			expectedError: true,
+			expectedCode:  expr.CodeUnknownFunction,
+			expectedPos:   2,
+		},
+		{
+			name:          "parse: invalid arity",
+			expression:    "sqrt(1,2)",
+			expectedError: true,
+			expectedCode:  expr.CodeInvalidArity,
+			expectedPos:   0,
+		},
+		{
+			name:          "parse: function without brackets",
+			expression:    "sin 1",
+			expectedError: true,
+			expectedCode:  expr.CodeUnexpectedToken,
+			expectedPos:   4,
+		},
+		{
+			name:          "parse: unclosed bracket",
+			expression:    "(1+2",
+			expectedError: true,
+			expectedCode:  expr.CodeBracketMismatch,
+			expectedPos:   0,
+		},
+		{
+			name:          "parse: extra bracket",
+			expression:    "1+2)",
+			expectedError: true,
+			expectedCode:  expr.CodeBracketMismatch,
+			expectedPos:   3,
+		},
+		{
+			name:          "parse: invalid symbol",
+			expression:    "1+$",
+			expectedError: true,
+			expectedCode:  expr.CodeInvalidSymbol,
+			expectedPos:   2,
+		},
+		{
+			name:          "parse: invalid number",
+			expression:    "1.2.3",
+			expectedError: true,
+			expectedCode:  expr.CodeInvalidNumber,
+			expectedPos:   0,
+		},
+		{
+			name:          "parse: position in characters",
+			expression:    "(√4)",
+			expectedError: true,
+			expectedCode:  expr.CodeInvalidSymbol,
+			expectedPos:   1,
+		},
+		{
+			name:          "parse: empty expression",
+			expression:    "",
+			expectedError: true,
+			expectedCode:  expr.CodeUnexpectedEnd,
+			expectedPos:   0,
+		},
+	}
+
+	for _, ts := range testParseCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.ParseWith(ts.expression, expr.Options{ImplicitMultiplication: ts.implicit})
+			if ts.expectedError {
+				var exprErr *expr.Error
+				if !errors.As(err, &exprErr) {
+					t.Fatalf("expected *expr.Error, got: %v", err)
+				}
+				if exprErr.Code != ts.expectedCode || exprErr.Pos != ts.expectedPos {
+					t.Errorf("invalid error, got: %s at %d, want: %s at %d", exprErr.Code, exprErr.Pos, ts.expectedCode, ts.expectedPos)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := expr.String(tree); got != ts.expectedTree {
+				t.Errorf("invalid tree, got: %s, want: %s", got, ts.expectedTree)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	tree, err := expr.Parse("(1+2)*(3-4)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var rpn []string
+	expr.Walk(tree, func(n expr.Node) error {
+		switch n := n.(type) {
+		case *expr.Number:
+			rpn = append(rpn, n.Text)
+		case *expr.Binary:
+			rpn = append(rpn, n.Op)
+		}
+		return nil
+	})
+
+	want := []string{"1", "2", "+", "3", "4", "-", "*"}
+	if len(rpn) != len(want) {
+		t.Fatalf("invalid order of nodes, got: %v, want: %v", rpn, want)
+	}
+	for i := range want {
+		if rpn[i] != want[i] {
+			t.Fatalf("invalid order of nodes, got: %v, want: %v", rpn, want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	vars := map[string]float64{"x": 2, "rate": 0.5}
+
+	testResolveCases := []struct {
+		name            string
+		expression      string
+		expectedError   bool
+		expectedTree    string
+		expectedUsed    int
+		expectedComplex bool
+	}{
+		{
+			name:         "resolve: constants",
+			expression:   "pi*e",
+			expectedTree: "(pi*e)",
+			expectedUsed: 0,
+		},
+		{
+			name:         "resolve: variables",
+			expression:   "x^2+max(x, rate)",
+			expectedTree: "((2^2)+max(2,0.5))",
+			expectedUsed: 2,
+		},
+		{
+			name:            "resolve: imaginary unit",
+			expression:      "sqrt(x)*i",
+			expectedTree:    "(sqrt(2)*i)",
+			expectedUsed:    1,
+			expectedComplex: true,
+		},
+		{
+			name:          "resolve: unknown variable",
+			expression:    "x+y",
+			expectedError: true,
+		},
+	}
+
+	for _, ts := range testResolveCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.Parse(ts.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			tree, used, err := expr.Resolve(tree, vars)
+			if ts.expectedError {
+				var exprErr *expr.Error
+				if !errors.As(err, &exprErr) || exprErr.Code != expr.CodeUnknownIdent {
+					t.Errorf("expected unknown identifier error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := expr.String(tree); got != ts.expectedTree {
+				t.Errorf("invalid tree, got: %s, want: %s", got, ts.expectedTree)
+			}
+			if got := expr.IsComplex(tree); got != ts.expectedComplex {
+				t.Errorf("invalid complex check, got: %v, want: %v", got, ts.expectedComplex)
+			}
+			if len(used) != ts.expectedUsed {
+				t.Errorf("invalid number of used variables, got: %d, want: %d", len(used), ts.expectedUsed)
+			}
+		})
+	}
+
+	for name, want := range map[string]bool{"x": true, "rate_2": true, "pi": false, "i": false, "and": false, "if": false, "sqrt": false, "2x": false, "a b": false, "": false} {
+		if got := expr.IsName(name); got != want {
+			t.Errorf("invalid name check of '%s', got: %v, want: %v", name, got, want)
+		}
+	}
+}
+
+func TestScript(t *testing.T) {
+	vars := map[string]float64{"x": 2}
+
+	testScriptCases := []struct {
+		name          string
+		script        string
+		expectedCode  string
+		expectedNames []string
+		expectedTrees []string
+		expectedUsed  int
+	}{
+		{
+			name:          "script: bindings",
+			script:        "a = 3*4; b = a+2; a*b",
+			expectedNames: []string{"a", "b", ""},
+			expectedTrees: []string{"(3*4)", "(a+2)", "(a*b)"},
+		},
+		{
+			name:          "script: variables and trailing semicolon",
+			script:        "y = x^2; y+x;",
+			expectedNames: []string{"y", ""},
+			expectedTrees: []string{"(2^2)", "(y+2)"},
+			expectedUsed:  1,
+		},
+		{
+			name:          "script: single expression",
+			script:        "1+2",
+			expectedNames: []string{""},
+			expectedTrees: []string{"(1+2)"},
+		},
+		{
+			name:         "script: unnamed statement in the middle",
+			script:       "a = 1; a+1; a",
+			expectedCode: expr.CodeUnexpectedToken,
+		},
+		{
+			name:         "script: invalid name",
+			script:       "pi = 3; pi",
+			expectedCode: expr.CodeInvalidName,
+		},
+		{
+			name:         "script: redefinition",
+			script:       "a = 1; a = 2; a",
+			expectedCode: expr.CodeRedefinition,
+		},
+		{
+			name:         "script: name used before binding",
+			script:       "a = b; b = 1; a",
+			expectedCode: expr.CodeUnknownIdent,
+		},
+		{
+			name:         "script: empty statement",
+			script:       "a = 1;; a",
+			expectedCode: expr.CodeUnexpectedToken,
+		},
+	}
+
+	for _, ts := range testScriptCases {
+		t.Run(ts.name, func(t *testing.T) {
+			stmts, err := expr.ParseScript(ts.script, expr.Options{})
+			var used map[string]float64
+			if err == nil {
+				stmts, used, err = expr.ResolveScript(stmts, vars)
+			}
+			if ts.expectedCode != "" {
+				var exprErr *expr.Error
+				if !errors.As(err, &exprErr) || exprErr.Code != ts.expectedCode {
+					t.Errorf("expected error with code %s, got: %v", ts.expectedCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(stmts) != len(ts.expectedNames) {
+				t.Fatalf("invalid number of statements, got: %d, want: %d", len(stmts), len(ts.expectedNames))
+			}
+			for i, stmt := range stmts {
+				if stmt.Name != ts.expectedNames[i] {
+					t.Errorf("invalid name of statement %d, got: %s, want: %s", i, stmt.Name, ts.expectedNames[i])
+				}
+				if got := expr.String(stmt.X); got != ts.expectedTrees[i] {
+					t.Errorf("invalid tree of statement %d, got: %s, want: %s", i, got, ts.expectedTrees[i])
+				}
+			}
+			if len(used) != ts.expectedUsed {
+				t.Errorf("invalid number of used variables, got: %d, want: %d", len(used), ts.expectedUsed)
+			}
+		})
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	funcs := make(map[string]*expr.Definition)
+	for _, src := range []string{"sq(x) = x^2", "f(x, y) = sq(x) + y"} {
+		def, err := expr.ParseDefinition(src, funcs)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		funcs[def.Name] = def
+	}
+	if def := funcs["f"]; len(def.Params) != 2 || def.Text != "sq(x) + y" {
+		t.Errorf("invalid definition, got: %v with body %s", def.Params, def.Text)
+	}
+
+	testDefinitionCases := []struct {
+		name         string
+		source       string
+		expectedCode string
+	}{
+		{name: "definition: constants and imaginary unit", source: "g(t) = pi*t + i"},
+		{name: "definition: name of built-in function", source: "sqrt(x) = x", expectedCode: expr.CodeInvalidName},
+		{name: "definition: repeated parameter", source: "g(x, x) = x", expectedCode: expr.CodeRedefinition},
+		{name: "definition: unknown name in body", source: "g(x) = x + y", expectedCode: expr.CodeUnknownIdent},
+		{name: "definition: recursion", source: "g(x) = if(x > 0, g(x - 1), 0)", expectedCode: expr.CodeRecursion},
+		{name: "definition: wrong arity of call", source: "g(x) = f(x)", expectedCode: expr.CodeInvalidArity},
+		{name: "definition: without parameters", source: "g() = 1", expectedCode: expr.CodeBracketMismatch},
+		{name: "definition: without body", source: "g(x) =", expectedCode: expr.CodeUnexpectedEnd},
+	}
+
+	for _, ts := range testDefinitionCases {
+		t.Run(ts.name, func(t *testing.T) {
+			_, err := expr.ParseDefinition(ts.source, funcs)
+			if ts.expectedCode == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			var exprErr *expr.Error
+			if !errors.As(err, &exprErr) || exprErr.Code != ts.expectedCode {
+				t.Errorf("expected error with code %s, got: %v", ts.expectedCode, err)
+			}
+		})
+	}
+
+	// every function calls the previous one twice, so the inlined tree doubles with each definition
+	doubling := map[string]*expr.Definition{}
+	var err error
+	last := 0
+	for k := 1; k <= 20 && err == nil; k++ {
+		src := fmt.Sprintf("d%d(x) = d%d(d%d(x))", k, k-1, k-1)
+		if k == 1 {
+			src = "d1(x) = x + 1"
+		}
+		var def *expr.Definition
+		if def, err = expr.ParseDefinition(src, doubling); err == nil {
+			doubling[def.Name] = def
+			last = k
+		}
+	}
+	var exprErr *expr.Error
+	if !errors.As(err, &exprErr) || exprErr.Code != expr.CodeTooLarge || last < 10 {
+		t.Errorf("expected error with code %s after at least 10 definitions, got: %v after %d", expr.CodeTooLarge, err, last)
+	}
+	tree, err := expr.ParseWith(fmt.Sprintf("d%d(1) + d%d(2)", last, last), expr.Options{Functions: doubling})
+	if err == nil {
+		_, err = expr.Inline(tree, doubling)
+	}
+	if !errors.As(err, &exprErr) || exprErr.Code != expr.CodeTooLarge {
+		t.Errorf("expected error with code %s for the expression, got: %v", expr.CodeTooLarge, err)
+	}
+
+	testInlineCases := []struct {
+		name         string
+		expression   string
+		expectedTree string
+		expectedCode string
+	}{
+		{name: "inline: nested calls", expression: "f(2, 3) * 2", expectedTree: "(((2^2)+3)*2)"},
+		{name: "inline: call in argument", expression: "sq(sq(x))", expectedTree: "((x^2)^2)"},
+		{name: "inline: wrong arity", expression: "f(1)", expectedCode: expr.CodeInvalidArity},
+	}
+
+	for _, ts := range testInlineCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.ParseWith(ts.expression, expr.Options{Functions: funcs})
+			if err == nil {
+				tree, err = expr.Inline(tree, funcs)
+			}
+			if ts.expectedCode != "" {
+				var exprErr *expr.Error
+				if !errors.As(err, &exprErr) || exprErr.Code != ts.expectedCode || !strings.Contains(exprErr.Msg, "'f'") {
+					t.Errorf("expected error with code %s naming the function, got: %v", ts.expectedCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := expr.String(tree); got != ts.expectedTree {
+				t.Errorf("invalid tree, got: %s, want: %s", got, ts.expectedTree)
+			}
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	testSimplifyCases := []struct {
+		name         string
+		expression   string
+		fold         bool
+		expectedTree string
+	}{
+		{name: "simplify: multiplication by one", expression: "x*1 + 1*y", expectedTree: "(x+y)"},
+		{name: "simplify: addition and subtraction of zero", expression: "0+x-0", expectedTree: "x"},
+		{name: "simplify: multiplication by zero", expression: "0*x + pi*0 + z", expectedTree: "z"},
+		{name: "simplify: multiplication by zero keeps operations", expression: "0*(x+y) + 0*log(0)", expectedTree: "((0*(x+y))+(0*log(0)))"},
+		{name: "simplify: powers", expression: "x^1 + y^0", expectedTree: "(x+1)"},
+		{name: "simplify: double negation", expression: "-(-x)", expectedTree: "x"},
+		{name: "simplify: subtraction from zero and of itself", expression: "(x - x) + 0/2 - (0-z)", expectedTree: "z"},
+		{name: "simplify: subtraction of itself keeps operations", expression: "(x*y - x*y) + 0/y", expectedTree: "(((x*y)-(x*y))+(0/y))"},
+		{name: "simplify: division of zero by zero", expression: "0/(1-1)", fold: true, expectedTree: "(0/0)"},
+		{name: "simplify: literal that is not exactly one", expression: "x*1.00000000000000000001", expectedTree: "(x*1.00000000000000000001)"},
+		{name: "simplify: without folding", expression: "2*3 + x", expectedTree: "((2*3)+x)"},
+		{name: "simplify: folding", expression: "2*3 + x/(4-2)", fold: true, expectedTree: "(6+(x/2))"},
+		{name: "simplify: folding keeps division by zero", expression: "x + 1/(2-2)", fold: true, expectedTree: "(x+(1/0))"},
+		{name: "simplify: folding in arguments", expression: "sqrt(2^4)", fold: true, expectedTree: "sqrt(16)"},
+	}
+
+	for _, ts := range testSimplifyCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.Parse(ts.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := expr.String(expr.Simplify(tree, ts.fold)); got != ts.expectedTree {
+				t.Errorf("invalid tree, got: %s, want: %s", got, ts.expectedTree)
+			}
+		})
+	}
+}
+
+func TestDerivative(t *testing.T) {
+	testDerivativeCases := []struct {
+		name          string
+		expression    string
+		expectedTree  string
+		expectedError bool
+	}{
+		{name: "derivative: polynomial", expression: "x^2 + 3*x", expectedTree: "((2*x)+3)"},
+		{name: "derivative: other names are constants", expression: "y*x + y", expectedTree: "y"},
+		{name: "derivative: product", expression: "sin(x)*x", expectedTree: "((cos(x)*x)+sin(x))"},
+		{name: "derivative: quotient", expression: "1/x", expectedTree: "(-1/(x^2))"},
+		{name: "derivative: quotient of equal operands", expression: "x/x", expectedTree: "0"},
+		{name: "derivative: exponent", expression: "2^x", expectedTree: "((2^x)*log(2))"},
+		{name: "derivative: chain rule", expression: "sqrt(x^2)", expectedTree: "((2*x)/(2*sqrt((x^2))))"},
+		{name: "derivative: conditional", expression: "if(x > 0, x, -x)", expectedTree: "if((x>0),1,-1)"},
+		{name: "derivative: modulo", expression: "x % 2", expectedError: true},
+		{name: "derivative: comparison", expression: "x < 2", expectedError: true},
+	}
+
+	for _, ts := range testDerivativeCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.Parse(ts.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			d, err := expr.Derivative(tree, "x")
+			if ts.expectedError {
+				var exprErr *expr.Error
+				if !errors.As(err, &exprErr) || exprErr.Code != expr.CodeNotDifferentiable {
+					t.Errorf("expected not differentiable error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := expr.String(expr.SimplifySymbolic(d, true)); got != ts.expectedTree {
+				t.Errorf("invalid derivative, got: %s, want: %s", got, ts.expectedTree)
+			}
+		})
+	}
+}
+
+func TestUnits(t *testing.T) {
+	testUnitsCases := []struct {
+		name         string
+		expression   string
+		expectedTree string
+		expectedUnit string
+		expectedCode string
+	}{
+		{name: "units: speed", expression: "5 km / 2 h", expectedTree: "(5 km/2 h)", expectedUnit: "m/s"},
+		{name: "units: conversion", expression: "3 ft to m", expectedTree: "(3 ft to m)", expectedUnit: "m"},
+		{name: "units: compound unit", expression: "90 km/h to m/s", expectedTree: "(90 km/h to m/s)", expectedUnit: "m/s"},
+		{name: "units: product with a variable", expression: "5 km * x", expectedTree: "(5 km*x)", expectedUnit: "m"},
+		{name: "units: power of unit", expression: "sqrt(4 m^2) + 1 ft", expectedTree: "(sqrt(4 m^2)+1 ft)", expectedUnit: "m"},
+		{name: "units: power of quantity", expression: "(2 s)^-2", expectedTree: "(2 s^(-2))", expectedUnit: "1/s^2"},
+		{name: "units: minutes and function min", expression: "min(2 min, 100 s)", expectedTree: "min(2 min,100 s)", expectedUnit: "s"},
+		{name: "units: numbers", expression: "2*3", expectedTree: "(2*3)", expectedUnit: ""},
+		{name: "units: addition of length and time", expression: "1 m + 1 s", expectedCode: expr.CodeDimensionMismatch},
+		{name: "units: function of quantity", expression: "sin(2 m)", expectedCode: expr.CodeDimensionMismatch},
+		{name: "units: conversion to other dimension", expression: "3 ft to kg", expectedCode: expr.CodeDimensionMismatch},
+		{name: "units: unknown unit", expression: "3 ft to parsec", expectedCode: expr.CodeUnknownUnit},
+		{name: "units: round of quantity", expression: "round(1.4 km)", expectedCode: expr.CodeDimensionMismatch},
+		{name: "units: logical operator of quantities", expression: "1 m and 2 s", expectedCode: expr.CodeDimensionMismatch},
+		{name: "units: negation of quantity", expression: "not 1 m", expectedCode: expr.CodeDimensionMismatch},
+		{name: "units: unit name after a quantity", expression: "2 kg * g", expectedTree: "2 kg*g", expectedUnit: "kg^2"},
+		{name: "units: too large power of unit", expression: "5 km^100000000", expectedCode: expr.CodeUnknownUnit},
+		{name: "units: too large power of quantity", expression: "(2 m)^100000000", expectedCode: expr.CodeDimensionMismatch},
+	}
+
+	for _, ts := range testUnitsCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.Parse(ts.expression)
+			var dim expr.Dimension
+			if err == nil {
+				dim, err = expr.Dimensions(tree, nil)
+			}
+			if ts.expectedCode != "" {
+				var exprErr *expr.Error
+				if !errors.As(err, &exprErr) || exprErr.Code != ts.expectedCode {
+					t.Errorf("expected error with code %s, got: %v", ts.expectedCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := expr.String(tree); got != ts.expectedTree {
+				t.Errorf("invalid tree, got: %s, want: %s", got, ts.expectedTree)
+			}
+			if got := expr.ResultUnit(tree, dim); got != ts.expectedUnit {
+				t.Errorf("invalid unit, got: %s, want: %s", got, ts.expectedUnit)
+			}
+		})
+	}
+
+	u, err := expr.ParseUnit("km/h")
+	if err != nil || u.Factor.RatString() != "5/18" || u.Dim != (expr.Dimension{1, 0, -1}) {
+		t.Errorf("invalid unit km/h, got: %v %v, %v", u.Factor, u.Dim, err)
+	}
+}
+
+func TestArrays(t *testing.T) {
+	testArraysCases := []struct {
+		name          string
+		expression    string
+		expectedTree  string
+		expectedShape []int
+		expectedCode  string
+	}{
+		{name: "arrays: vector", expression: "[1, 2, 3]", expectedTree: "[1,2,3]", expectedShape: []int{3}},
+		{name: "arrays: matrix", expression: "[[1,2],[3,4],[5,6]]", expectedTree: "[[1,2],[3,4],[5,6]]", expectedShape: []int{3, 2}},
+		{name: "arrays: elementwise arithmetic", expression: "2*[1,2] - [x,1]", expectedTree: "((2*[1,2])-[x,1])", expectedShape: []int{2}},
+		{name: "arrays: elementwise function", expression: "sqrt([4,9])", expectedTree: "sqrt([4,9])", expectedShape: []int{2}},
+		{name: "arrays: transpose", expression: "transpose([[1,2,3],[4,5,6]])", expectedTree: "transpose([[1,2,3],[4,5,6]])", expectedShape: []int{3, 2}},
+		{name: "arrays: dot product", expression: "dot([1,2],[3,4])", expectedTree: "dot([1,2],[3,4])"},
+		{name: "arrays: determinant", expression: "det([[1,2],[3,4]]) + 1", expectedTree: "(det([[1,2],[3,4]])+1)"},
+		{name: "arrays: different lengths", expression: "[1,2] + [1,2,3]", expectedCode: expr.CodeShapeMismatch},
+		{name: "arrays: ragged matrix", expression: "[[1,2],[3]]", expectedCode: expr.CodeShapeMismatch},
+		{name: "arrays: three dimensions", expression: "[[[1]]]", expectedCode: expr.CodeShapeMismatch},
+		{name: "arrays: determinant of non-square matrix", expression: "det([[1,2,3],[4,5,6]])", expectedCode: expr.CodeShapeMismatch},
+		{name: "arrays: function of numbers", expression: "max([1,2], 3)", expectedCode: expr.CodeShapeMismatch},
+		{name: "arrays: unclosed bracket", expression: "[1,2", expectedCode: expr.CodeBracketMismatch},
+		{name: "arrays: empty", expression: "[]", expectedCode: expr.CodeBracketMismatch},
+	}
+
+	for _, ts := range testArraysCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.Parse(ts.expression)
+			var shape []int
+			if err == nil {
+				shape, err = expr.Shape(tree, nil)
+			}
+			if ts.expectedCode != "" {
+				var exprErr *expr.Error
+				if !errors.As(err, &exprErr) || exprErr.Code != ts.expectedCode {
+					t.Errorf("expected error with code %s, got: %v", ts.expectedCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := expr.String(tree); got != ts.expectedTree {
+				t.Errorf("invalid tree, got: %s, want: %s", got, ts.expectedTree)
+			}
+			if !slices.Equal(shape, ts.expectedShape) {
+				t.Errorf("invalid shape, got: %v, want: %v", shape, ts.expectedShape)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	testFormatCases := []struct {
+		name              string
+		expression        string
+		expectedCanonical string
+	}{
+		{name: "format: spaces", expression: "1+2*3", expectedCanonical: "1 + 2 * 3"},
+		{name: "format: redundant brackets", expression: "((1+2))+(3*4)", expectedCanonical: "1 + 2 + 3 * 4"},
+		{name: "format: needed brackets", expression: "(1+2)*(3-4)/(5*6)", expectedCanonical: "(1 + 2) * (3 - 4) / (5 * 6)"},
+		{name: "format: right operand of the same level", expression: "1-(2-3)+(4+5)", expectedCanonical: "1 - (2 - 3) + (4 + 5)"},
+		{name: "format: power", expression: "2^3^2 + (2^3)^2 + 2^-x + (-2)^2", expectedCanonical: "2^3^2 + (2^3)^2 + 2^-x + (-2)^2"},
+		{name: "format: minus of a power", expression: "-(2^2) - x^2 + -(x^2) + (-x)^2", expectedCanonical: "-2^2 - x^2 + -x^2 + (-x)^2"},
+		{name: "format: functions and arrays", expression: "max( 1,2 ,x)*dot([1,2],[3 ,4])", expectedCanonical: "max(1, 2, x) * dot([1, 2], [3, 4])"},
+		{name: "format: logic and comparisons", expression: "not (x>1) and (y<2 or z==3)", expectedCanonical: "not x > 1 and (y < 2 or z == 3)"},
+		{name: "format: bitwise", expression: "(0xFF&0b1010)|(1<<(2+1))", expectedCanonical: "0xFF & 0b1010 | 1 << 2 + 1"},
+		{name: "format: postfix", expression: "-3! + (2+3)! + 200*15% - 7%(-3) + -(2%)", expectedCanonical: "-3! + (2 + 3)! + 200 * 15% - 7 % (-3) + -2%"},
+		{name: "format: units", expression: "(2 s)^-2 + 5km/2h", expectedCanonical: "(2 s)^-2 + 5 km / 2 h"},
+		{name: "format: conversion", expression: "(90km/h)to m/s", expectedCanonical: "90 km/h to m/s"},
+		{name: "format: quantity at the end of a unary operand", expression: "(-3 m^3) * m", expectedCanonical: "(-3 m^3) * m"},
+		{name: "format: quantity at the end of a binary operand", expression: "(x * 3 m^2) * km", expectedCanonical: "(x * 3 m^2) * km"},
+		{name: "format: quantity at the end of a bracketed operand", expression: "(x * (3 m + 1 m)) * km", expectedCanonical: "x * (3 m + 1 m) * km"},
+	}
+
+	for _, ts := range testFormatCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.Parse(ts.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			canonical := expr.Format(tree)
+			if canonical != ts.expectedCanonical {
+				t.Errorf("invalid canonical form, got: %s, want: %s", canonical, ts.expectedCanonical)
+			}
+			again, err := expr.Parse(canonical)
+			if err != nil {
+				t.Fatalf("canonical form doesn't parse: %s", err)
+			}
+			if expr.String(again) != expr.String(tree) {
+				t.Errorf("canonical form changes the tree, got: %s, want: %s", expr.String(again), expr.String(tree))
+			}
+		})
+	}
+
+	stmts, err := expr.ParseScript("a=3*4 ;b=a+2; a*b", expr.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := expr.FormatScript(stmts); got != "a = 3 * 4; b = a + 2; a * b" {
+		t.Errorf("invalid canonical script, got: %s", got)
+	}
+
+	// a negative number folded by Simplify is a base in brackets like the minus of a number
+	tree, err := expr.Parse("(2-5)^x")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := expr.Format(expr.Simplify(tree, true)); got != "(-3)^x" {
+		t.Errorf("invalid canonical form of folded number, got: %s, want: (-3)^x", got)
+	}
+}
+
+func TestLaTeX(t *testing.T) {
+	testLaTeXCases := []struct {
+		name          string
+		expression    string
+		expectedLaTeX string
+	}{
+		{name: "latex: fraction", expression: "(1+2)/3", expectedLaTeX: `\frac{1 + 2}{3}`},
+		{name: "latex: nested fractions and products", expression: "2*(1/3) + (a*b)/(c-1)", expectedLaTeX: `2 \cdot \frac{1}{3} + \frac{a \cdot b}{c - 1}`},
+		{name: "latex: floor division and modulo", expression: "7//2 + 7%(-3)", expectedLaTeX: `\left\lfloor \frac{7}{2} \right\rfloor + 7 \bmod \left(-3\right)`},
+		{name: "latex: powers", expression: "2^3^2 + (2^3)^2 + (-2)^2 + -(x^2) + (1/2)^n", expectedLaTeX: `2^{3^{2}} + \left(2^{3}\right)^{2} + \left(-2\right)^{2} + \left(-x^{2}\right) + \left(\frac{1}{2}\right)^{n}`},
+		{name: "latex: signs", expression: "2 - -3 + -(a+b) - -(1/2)", expectedLaTeX: `2 - \left(-3\right) + \left(-\left(a + b\right)\right) - \left(-\frac{1}{2}\right)`},
+		{name: "latex: functions", expression: "sqrt(x+1) + abs(-x) + log(x) + sin(pi*x) + max(1, 2) + round(x)", expectedLaTeX: `\sqrt{x + 1} + \left|-x\right| + \ln\left(x\right) + \sin\left(\pi \cdot x\right) + \max\left(1, 2\right) + \operatorname{round}\left(x\right)`},
+		{name: "latex: if", expression: "if(x != 0, 1/x, 0)", expectedLaTeX: `\begin{cases} \frac{1}{x} & \text{if } x \neq 0 \\ 0 & \text{otherwise} \end{cases}`},
+		{name: "latex: names", expression: "x1 + rate + my_var + e", expectedLaTeX: `x_{1} + \mathrm{rate} + \mathrm{my\_var} + e`},
+		{name: "latex: numbers", expression: "1.5e3 + 2e-7 + 3i + 0xFF", expectedLaTeX: `1.5 \cdot 10^{3} + 2 \cdot 10^{-7} + 3i + \mathtt{0xFF}`},
+		{name: "latex: logic and bitwise", expression: "not (x>=1) and y<=2 or 0b1010 & 3 | 1 << 2 >> 1", expectedLaTeX: `\lnot \left(x \geq 1\right) \land y \leq 2 \lor \mathtt{0b1010} \mathbin{\&} 3 \mathbin{|} 1 \ll 2 \gg 1`},
+		{name: "latex: postfix", expression: "3! + (2+3)! + 200*15%", expectedLaTeX: `3! + \left(2 + 3\right)! + 200 \cdot 15\%`},
+		{name: "latex: units", expression: "5 km/2 h + (2 s)^2 + 4 m^2", expectedLaTeX: `\frac{5\,\mathrm{km}}{2\,\mathrm{h}} + \left(2\,\mathrm{s}\right)^{2} + 4\,\mathrm{m}^{2}`},
+		{name: "latex: conversion", expression: "90 km/h * 2 to m*s^-1", expectedLaTeX: `90\,\mathrm{km}/\mathrm{h} \cdot 2 \to \mathrm{m} \cdot \mathrm{s}^{-1}`},
+		{name: "latex: arrays", expression: "[1,2,3] * 2 + det([[1,2],[3,4]]) + transpose(m) + dot([1,2],[3,4])", expectedLaTeX: `\begin{pmatrix} 1 & 2 & 3 \end{pmatrix} \cdot 2 + \begin{vmatrix} 1 & 2 \\ 3 & 4 \end{vmatrix} + m^{\mathsf{T}} + \begin{pmatrix} 1 & 2 \end{pmatrix} \cdot \begin{pmatrix} 3 & 4 \end{pmatrix}`},
+	}
+
+	for _, ts := range testLaTeXCases {
+		t.Run(ts.name, func(t *testing.T) {
+			tree, err := expr.Parse(ts.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := expr.LaTeX(tree); got != ts.expectedLaTeX {
+				t.Errorf("invalid latex, got: %s, want: %s", got, ts.expectedLaTeX)
+			}
+		})
+	}
+
+	stmts, err := expr.ParseScript("a=3*4 ;b=a/2; a*b", expr.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := expr.LaTeXScript(stmts); got != `a = 3 \cdot 4;\quad b = \frac{a}{2};\quad a \cdot b` {
+		t.Errorf("invalid latex of script, got: %s", got)
+	}
+}
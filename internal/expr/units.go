@@ -0,0 +1,362 @@
+package expr
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Dimension is a physical dimension as the powers of length, mass and time.
+type Dimension [3]int
+
+// baseUnits are the units of the dimensions in which quantities are computed.
+var baseUnits = [3]string{"m", "kg", "s"}
+
+// Unit is a unit of measurement, Factor converts a magnitude in the unit to the base units.
+type Unit struct {
+	Factor *big.Rat
+	Dim    Dimension
+}
+
+// Units are the units that can follow a number literal, for example 5 km.
+// Factors are exact, so quantities can also be computed in the exact mode.
+var Units = map[string]Unit{
+	"m":   unit("1", Dimension{1, 0, 0}),
+	"km":  unit("1000", Dimension{1, 0, 0}),
+	"cm":  unit("0.01", Dimension{1, 0, 0}),
+	"mm":  unit("0.001", Dimension{1, 0, 0}),
+	"ft":  unit("0.3048", Dimension{1, 0, 0}),
+	"in":  unit("0.0254", Dimension{1, 0, 0}),
+	"mi":  unit("1609.344", Dimension{1, 0, 0}),
+	"kg":  unit("1", Dimension{0, 1, 0}),
+	"g":   unit("0.001", Dimension{0, 1, 0}),
+	"lb":  unit("0.45359237", Dimension{0, 1, 0}),
+	"s":   unit("1", Dimension{0, 0, 1}),
+	"ms":  unit("0.001", Dimension{0, 0, 1}),
+	"min": unit("60", Dimension{0, 0, 1}),
+	"h":   unit("3600", Dimension{0, 0, 1}),
+}
+
+// maxUnitPower limits the powers of units and the integer exponents of quantities,
+// so that the factors and the dimensions of units stay small.
+const maxUnitPower = 10
+
+// Conversion is the operator that converts a quantity to the unit that follows it, for example 3 ft to m.
+const Conversion = "to"
+
+func unit(factor string, dim Dimension) Unit {
+	r, _ := new(big.Rat).SetString(factor)
+	return Unit{Factor: r, Dim: dim}
+}
+
+// ParseUnit returns the unit of a product of units with integer powers, for example km/h or m^2.
+func ParseUnit(text string) (Unit, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return Unit{}, err
+	}
+	p := &parser{tokens: tokens}
+	_, u, err := p.unit()
+	if err != nil {
+		return Unit{}, err
+	}
+	if tok := p.peek(); tok.kind != eof {
+		return Unit{}, unexpected(tok)
+	}
+	return u, nil
+}
+
+// isUnit reports whether the next token starts a unit, a name of a function followed by a bracket is a call.
+func (p *parser) isUnit() bool {
+	tok := p.peek()
+	_, ok := Units[tok.text]
+	return ok && tok.kind == ident && p.tokens[p.i+1].kind != lparen
+}
+
+// unit parses a product of units, the text of the unit is returned without spaces.
+//
+//	unit   = power { ("*" | "/") power }
+//	power  = ident [ "^" ["-"] number ]
+func (p *parser) unit() (string, Unit, error) {
+	var sb strings.Builder
+	u := Unit{Factor: big.NewRat(1, 1)}
+	sign := 1
+	for {
+		name := p.next()
+		base, ok := Units[name.text]
+		if name.kind != ident {
+			return "", Unit{}, unexpected(name)
+		}
+		if !ok {
+			return "", Unit{}, errorf(CodeUnknownUnit, name.pos, "unknown unit '%s'", name.text)
+		}
+		sb.WriteString(name.text)
+
+		power := 1
+		if tok := p.peek(); tok.kind == operator && tok.text == "^" {
+			p.next()
+			text := ""
+			if tok := p.peek(); tok.kind == operator && tok.text == "-" {
+				text = p.next().text
+			}
+			num := p.next()
+			n, err := strconv.Atoi(text + num.text)
+			if num.kind != number || err != nil || abs(n) > maxUnitPower {
+				return "", Unit{}, errorf(CodeUnknownUnit, num.pos, "power of unit must be an integer from -%d to %d", maxUnitPower, maxUnitPower)
+			}
+			power = n
+			sb.WriteString("^" + text + num.text)
+		}
+
+		for i := range u.Dim {
+			u.Dim[i] += sign * power * base.Dim[i]
+		}
+		for range abs(power) {
+			if (power > 0) == (sign > 0) {
+				u.Factor.Mul(u.Factor, base.Factor)
+			} else {
+				u.Factor.Quo(u.Factor, base.Factor)
+			}
+		}
+
+		// the operator is a part of the unit only if a unit follows it, 5 km * x is a product,
+		// but 2 kg * g is a quantity in kg*g even if g is a variable, (2 kg) * g multiplies by it
+		tok := p.peek()
+		if tok.kind != operator || (tok.text != "*" && tok.text != "/") {
+			return sb.String(), u, nil
+		}
+		p.next()
+		if !p.isUnit() {
+			p.i--
+			return sb.String(), u, nil
+		}
+		sb.WriteString(tok.text)
+		sign = 1
+		if tok.text == "/" {
+			sign = -1
+		}
+	}
+}
+
+// String returns the dimension in the base units, for example m/s^2, it is empty for numbers.
+func (d Dimension) String() string {
+	var num, den []string
+	for i, power := range d {
+		switch {
+		case power == 1:
+			num = append(num, baseUnits[i])
+		case power > 1:
+			num = append(num, fmt.Sprintf("%s^%d", baseUnits[i], power))
+		case power == -1:
+			den = append(den, baseUnits[i])
+		case power < -1:
+			den = append(den, fmt.Sprintf("%s^%d", baseUnits[i], -power))
+		}
+	}
+	s := strings.Join(num, "*")
+	if len(den) > 0 {
+		if s == "" {
+			s = "1"
+		}
+		s += "/" + strings.Join(den, "/")
+	}
+	return s
+}
+
+// Dimensions returns the dimension of the tree and checks that the dimensions of the operands
+// agree: only quantities of the same dimension can be added or compared, functions like sin
+// accept only numbers. names are the dimensions of the names bound by a script.
+func Dimensions(n Node, names map[string]Dimension) (Dimension, error) {
+	var none Dimension
+	switch n := n.(type) {
+	case *Number:
+		if n.Unit == "" {
+			return none, nil
+		}
+		u, err := ParseUnit(n.Unit)
+		return u.Dim, err
+	case *Ident:
+		return names[n.Name], nil
+	case *Array:
+		var elem Dimension
+		for i, e := range n.Elems {
+			d, err := Dimensions(e, names)
+			if err != nil {
+				return none, err
+			}
+			if i > 0 && d != elem {
+				return none, mismatch(e.Pos(), elem, d)
+			}
+			elem = d
+		}
+		return elem, nil
+	case *Unary:
+		x, err := Dimensions(n.X, names)
+		if err == nil && n.Op == "!" && x != none {
+			return none, errorf(CodeDimensionMismatch, n.Position, "factorial expects a number, got %s", dimensionName(x))
+		}
+		if err == nil && n.Op == "not" && x != none {
+			return none, errorf(CodeDimensionMismatch, n.Position, "operator 'not' expects a number, got %s", dimensionName(x))
+		}
+		if n.Op == "not" {
+			return none, err
+		}
+		return x, err
+	case *Binary:
+		x, err := Dimensions(n.X, names)
+		if err != nil {
+			return none, err
+		}
+		if n.Op == Conversion {
+			u, err := ParseUnit(n.Y.(*Number).Unit)
+			if err != nil {
+				return none, err
+			}
+			if x != u.Dim {
+				return none, mismatch(n.Position, x, u.Dim)
+			}
+			return x, nil
+		}
+		y, err := Dimensions(n.Y, names)
+		if err != nil {
+			return none, err
+		}
+		switch n.Op {
+		case "*":
+			return x.add(y, 1), nil
+		case "/":
+			return x.add(y, -1), nil
+		case "^", "**":
+			if y != none {
+				return none, errorf(CodeDimensionMismatch, n.Y.Pos(), "exponent must be a number, got %s", dimensionName(y))
+			}
+			if x == none {
+				return none, nil
+			}
+			e, ok := exponent(n.Y)
+			if !ok {
+				return none, errorf(CodeDimensionMismatch, n.Y.Pos(), "exponent of a quantity in %s must be an integer literal from -%d to %d", dimensionName(x), maxUnitPower, maxUnitPower)
+			}
+			return none.add(x, e), nil
+		case "and", "or", "&", "|", "<<", ">>":
+			kind := "integers"
+			if n.Op == "and" || n.Op == "or" {
+				kind = "numbers"
+			}
+			for _, d := range []Dimension{x, y} {
+				if d != none {
+					return none, errorf(CodeDimensionMismatch, n.Position, "operator '%s' expects %s, got %s", n.Op, kind, dimensionName(d))
+				}
+			}
+			return none, nil
+		}
+		if x != y {
+			return none, mismatch(n.Position, x, y)
+		}
+		if n.Op == "+" || n.Op == "-" || n.Op == "%" {
+			return x, nil
+		}
+		return none, nil
+	case *Call:
+		dims := make([]Dimension, len(n.Args))
+		for i, arg := range n.Args {
+			d, err := Dimensions(arg, names)
+			if err != nil {
+				return none, err
+			}
+			dims[i] = d
+		}
+		switch n.Func {
+		case "if":
+			if dims[1] != dims[2] {
+				return none, mismatch(n.Position, dims[1], dims[2])
+			}
+			return dims[1], nil
+		case "sqrt":
+			for _, power := range dims[0] {
+				if power%2 != 0 {
+					return none, errorf(CodeDimensionMismatch, n.Position, "square root of %s is not a unit", dimensionName(dims[0]))
+				}
+			}
+			return dims[0].half(), nil
+		case "dot":
+			return dims[0].add(dims[1], 1), nil
+		case "abs", "min", "max", "transpose":
+			for _, d := range dims[1:] {
+				if d != dims[0] {
+					return none, mismatch(n.Position, dims[0], d)
+				}
+			}
+			return dims[0], nil
+		}
+		for i, d := range dims {
+			if d != none {
+				return none, errorf(CodeDimensionMismatch, n.Args[i].Pos(), "function '%s' expects a number, got %s", n.Func, dimensionName(d))
+			}
+		}
+	}
+	return none, nil
+}
+
+// ResultUnit returns the unit of the result of the tree with the dimension d,
+// it is the unit of the conversion at the root or the base units otherwise.
+func ResultUnit(n Node, d Dimension) string {
+	if b, ok := n.(*Binary); ok && b.Op == Conversion {
+		return b.Y.(*Number).Unit
+	}
+	return d.String()
+}
+
+func (d Dimension) add(o Dimension, k int) Dimension {
+	for i := range d {
+		d[i] += k * o[i]
+	}
+	return d
+}
+
+func (d Dimension) half() Dimension {
+	for i := range d {
+		d[i] /= 2
+	}
+	return d
+}
+
+func mismatch(pos int, x, y Dimension) error {
+	return errorf(CodeDimensionMismatch, pos, "dimensions '%s' and '%s' don't match", dimensionName(x), dimensionName(y))
+}
+
+// exponent returns the integer literal of an exponent, the sign of the literal is applied to it,
+// literals greater than maxUnitPower are rejected.
+func exponent(n Node) (int, bool) {
+	sign := 1
+	for {
+		u, ok := n.(*Unary)
+		if !ok || (u.Op != "-" && u.Op != "+") {
+			break
+		}
+		if u.Op == "-" {
+			sign = -sign
+		}
+		n = u.X
+	}
+	num, ok := n.(*Number)
+	if !ok || num.Imag || num.Value > maxUnitPower || num.Value != float64(int(num.Value)) {
+		return 0, false
+	}
+	return sign * int(num.Value), true
+}
+
+func dimensionName(d Dimension) string {
+	if s := d.String(); s != "" {
+		return s
+	}
+	return "number"
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
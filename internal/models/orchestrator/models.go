@@ -1,17 +1,142 @@
 package models
 
+import "encoding/json"
+
 type CalculateRequest struct {
 	Expression string `json:"expression"`
+	// Precision is "float" (by default), "exact" for computing with arbitrary precision
+	// or "complex" for computing with complex numbers, it is chosen automatically for expressions with i.
+	Precision string `json:"precision"`
+	// ImplicitMultiplication allows expressions like 2(3+4) or 3pi, it is off by default.
+	ImplicitMultiplication bool `json:"implicit_multiplication"`
+	// Simplify folds identities like x*1 and computes identical subexpressions once, it is off by default.
+	Simplify bool `json:"simplify"`
+}
+
+// ScriptRequest contains statements separated by ';', every statement except the last one
+// binds the result of its expression to a name, like a = 3*4; b = a+2; a*b.
+type ScriptRequest struct {
+	Script                 string `json:"script"`
+	Precision              string `json:"precision"`
+	ImplicitMultiplication bool   `json:"implicit_multiplication"`
+	Simplify               bool   `json:"simplify"`
+}
+
+// DerivativeRequest contains an expression and the name of the variable of differentiation.
+// With At the derivative is also computed at the point, as a script like x = 2; 2*x.
+type DerivativeRequest struct {
+	Expression string   `json:"expression"`
+	Variable   string   `json:"variable"`
+	At         *float64 `json:"at"`
+	Precision  string   `json:"precision"`
+}
+
+// DerivativeResponse contains Id of the expression computing the derivative at the point, if it was requested.
+type DerivativeResponse struct {
+	Derivative string `json:"derivative"`
+	Id         int    `json:"id,omitempty"`
+}
+
+// FormatResponse is the canonical form of an expression or a script.
+type FormatResponse struct {
+	Canonical string `json:"canonical"`
+}
+
+// RenderResponse is an expression or a script as a LaTeX formula.
+type RenderResponse struct {
+	Latex string `json:"latex"`
+}
+
+type ErrorResponse struct {
+	Code     string `json:"code"`
+	Position int    `json:"position"`
+	Message  string `json:"message"`
 }
 
 type CalculateResponse struct {
 	Id int `json:"id"`
 }
 
+// DryRunResponse is the plan of an expression that is checked without being saved.
+// Edges are the pairs of ids of tasks [from, to], where the task to waits for the task from.
+// EstimatedTimeMs is the time of the longest chain of dependent tasks, that is the time
+// of the expression when there are enough agents, TotalTimeMs is the time of all tasks
+// computed one after another. Both branches of if are counted.
+type DryRunResponse struct {
+	Precision       string        `json:"precision"`
+	Tasks           []PlannedTask `json:"tasks"`
+	Edges           [][2]int      `json:"edges"`
+	TasksSaved      int           `json:"tasks_saved,omitempty"`
+	EstimatedTimeMs int64         `json:"estimated_time_ms"`
+	TotalTimeMs     int64         `json:"total_time_ms"`
+}
+
+// PlannedTask is a task of the plan of an expression. An argument is null when it is the result
+// of another task, Condition and Branch are set for the tasks of if.
+type PlannedTask struct {
+	Id        int    `json:"id"`
+	Operation string `json:"operation"`
+	Arg1      any    `json:"arg1"`
+	Arg2      any    `json:"arg2"`
+	Condition int    `json:"condition,omitempty"`
+	Branch    int    `json:"branch,omitempty"`
+	TimeMs    int64  `json:"time_ms"`
+}
+
+// ExpressionResponse contains ExactResult for expressions computed in the exact mode
+// or when the format of the result is requested. Result and Imag are the real and
+// the imaginary parts of the result of an expression computed with complex numbers.
+// TasksSaved is the number of tasks that simplification of the expression saved.
+// Result of an expression with quantities is the magnitude in Unit. Result is omitted when
+// an exact result doesn't fit into a float, ExactResult is the result then.
+// Value is the vector or the matrix of a calculated expression whose value is an array.
+// Canonical is the expression printed with minimal brackets and consistent spacing.
+// BaseResult is an integer result in the base requested by the query parameter base, for example 0xff.
+// Latex and LatexResult are the expression and the result of a calculated expression as LaTeX formulas,
+// they are returned with the query parameter format=latex.
 type ExpressionResponse struct {
-	Id     int     `json:"id"`
-	Status string  `json:"status"`
-	Result float64 `json:"result"`
+	Id          int                `json:"id"`
+	Canonical   string             `json:"canonical,omitempty"`
+	Latex       string             `json:"latex,omitempty"`
+	Status      string             `json:"status"`
+	Result      *float64           `json:"result,omitempty"`
+	Imag        float64            `json:"imag,omitempty"`
+	Precision   string             `json:"precision"`
+	ExactResult string             `json:"exact_result,omitempty"`
+	Variables   map[string]float64 `json:"variables,omitempty"`
+	Bindings    []Binding          `json:"bindings,omitempty"`
+	TasksSaved  int                `json:"tasks_saved,omitempty"`
+	Unit        string             `json:"unit,omitempty"`
+	Value       json.RawMessage    `json:"value,omitempty"`
+	BaseResult  string             `json:"base_result,omitempty"`
+	LatexResult string             `json:"latex_result,omitempty"`
+}
+
+// Binding is a value bound to a name by a statement of a script. Like Result of an expression,
+// Value is omitted when an exact value doesn't fit into a float.
+type Binding struct {
+	Name       string   `json:"name"`
+	Status     string   `json:"status"`
+	Value      *float64 `json:"value,omitempty"`
+	Imag       float64  `json:"imag,omitempty"`
+	ExactValue string   `json:"exact_value,omitempty"`
+	Unit       string   `json:"unit,omitempty"`
+}
+
+type Variable struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// FunctionRequest contains the definition of a function, like f(x, y) = x^2 + y.
+type FunctionRequest struct {
+	Definition string `json:"definition"`
+}
+
+type Function struct {
+	Name   string   `json:"name"`
+	Params []string `json:"params"`
+	Body   string   `json:"body"`
 }
 
 type TaskRequest struct {
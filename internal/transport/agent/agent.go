@@ -3,8 +3,11 @@ package agent
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/big"
 	"sync"
 	"time"
 
@@ -14,24 +17,19 @@ import (
 )
 
 type Agent struct {
-	db                  *sql.DB
-	grpc_port           string
-	timeAdditon         time.Duration
-	timeSubtraction     time.Duration
-	timeMultiplications time.Duration
-	timeDivisions       time.Duration
-	workers             int
+	db        *sql.DB
+	grpc_port string
+	durations map[string]time.Duration
+	workers   int
 }
 
-func New(db *sql.DB, grpc_port int, ta, ts, tm, td time.Duration, workers int) *Agent {
+// New creates an agent, durations contains the time of computing for every operation.
+func New(db *sql.DB, grpc_port int, durations map[string]time.Duration, workers int) *Agent {
 	return &Agent{
-		db:                  db,
-		grpc_port:           fmt.Sprint(grpc_port),
-		timeAdditon:         ta,
-		timeSubtraction:     ts,
-		timeMultiplications: tm,
-		timeDivisions:       td,
-		workers:             workers,
+		db:        db,
+		grpc_port: fmt.Sprint(grpc_port),
+		durations: durations,
+		workers:   workers,
 	}
 }
 
@@ -64,36 +62,250 @@ func (a *Agent) MustRun() {
 
 				log.Printf("%s: get task, goroutine: %d, login: %s, expression: %d, task: %d, arg1: %f, arg2: %f, operation: %s\n", op, i, tsk.GetLogin(), tsk.GetIdExpression(), tsk.GetIdTask(), tsk.GetArg1(), tsk.GetArg2(), tsk.GetOperation())
 
-				res, duration := a.work(tsk.GetArg1(), tsk.GetArg2(), tsk.GetOperation())
-
-				log.Printf("%s: post task, goroutine: %d, login: %s, expression: %d, task: %d, operation time: %d, result: %f\n", op, i, tsk.GetLogin(), tsk.GetIdExpression(), tsk.GetIdTask(), duration, res)
+				var res float64
+				var exact string
+				var duration time.Duration
+				var imaginary float64
+				switch tsk.GetPrecision() {
+				case "exact":
+					var r *big.Rat
+					r, duration, err = a.workExact(tsk.GetExactArg1(), tsk.GetExactArg2(), tsk.GetOperation())
+					if err == nil {
+						exact = r.RatString()
+						res, _ = r.Float64()
+					}
+				case "complex":
+					var c complex128
+					c, duration, err = a.workComplex(complex(tsk.GetArg1(), tsk.GetImag1()), complex(tsk.GetArg2(), tsk.GetImag2()), tsk.GetOperation())
+					res, imaginary = real(c), imag(c)
+				default:
+					res, duration, err = a.work(tsk.GetArg1(), tsk.GetArg2(), tsk.GetOperation())
+				}
 
-				client.PostTask(context.TODO(), &task.PostTaskRequest{
+				req := &task.PostTaskRequest{
 					Login:         tsk.GetLogin(),
 					IdExpression:  tsk.GetIdExpression(),
 					IdTask:        tsk.GetIdTask(),
 					OperationTime: int64(duration),
 					Result:        res,
-				})
+					ImagResult:    imaginary,
+					ExactResult:   exact,
+				}
+				if err != nil {
+					req.Error = err.Error()
+					log.Printf("%s: post task, goroutine: %d, login: %s, expression: %d, task: %d, operation time: %d, error: %s\n", op, i, tsk.GetLogin(), tsk.GetIdExpression(), tsk.GetIdTask(), duration, err)
+				} else {
+					log.Printf("%s: post task, goroutine: %d, login: %s, expression: %d, task: %d, operation time: %d, result: %f\n", op, i, tsk.GetLogin(), tsk.GetIdExpression(), tsk.GetIdTask(), duration, res)
+				}
+
+				client.PostTask(context.TODO(), req)
 			}
 		}(i + 1)
 	}
 	wg.Wait()
 }
 
-func (a *Agent) work(arg1, arg2 float32, oper string) (float32, time.Duration) {
+func (a *Agent) work(arg1, arg2 float64, oper string) (float64, time.Duration, error) {
+	duration, ok := a.durations[oper]
+	if !ok {
+		return 0, 0, errors.New("unknown operation: " + oper)
+	}
+	<-time.After(duration)
+	res, err := calculate(arg1, arg2, oper)
+	return res, duration, err
+}
+
+// workExact is the same as work for the tasks of expressions in the exact mode.
+func (a *Agent) workExact(arg1, arg2, oper string) (*big.Rat, time.Duration, error) {
+	duration, ok := a.durations[oper]
+	if !ok {
+		return nil, 0, errors.New("unknown operation: " + oper)
+	}
+	<-time.After(duration)
+	res, err := calculateExact(arg1, arg2, oper)
+	return res, duration, err
+}
+
+// workComplex is the same as work for the tasks of expressions with complex numbers.
+func (a *Agent) workComplex(arg1, arg2 complex128, oper string) (complex128, time.Duration, error) {
+	duration, ok := a.durations[oper]
+	if !ok {
+		return 0, 0, errors.New("unknown operation: " + oper)
+	}
+	<-time.After(duration)
+	res, err := calculateComplex(arg1, arg2, oper)
+	return res, duration, err
+}
+
+// calculate computes the operation and fails if the result isn't a finite number,
+// so that an overflow ends the expression with an error instead of reaching other tasks.
+func calculate(arg1, arg2 float64, oper string) (float64, error) {
+	res, err := operate(arg1, arg2, oper)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsInf(res, 0) {
+		return 0, errTooLarge
+	}
+	if math.IsNaN(res) {
+		return 0, errNotNumber
+	}
+	return res, nil
+}
+
+func operate(arg1, arg2 float64, oper string) (float64, error) {
 	switch oper {
 	case "+":
-		<-time.After(a.timeAdditon)
-		return arg1 + arg2, a.timeAdditon
+		return arg1 + arg2, nil
 	case "-":
-		<-time.After(a.timeSubtraction)
-		return arg1 - arg2, a.timeSubtraction
+		return arg1 - arg2, nil
 	case "*":
-		<-time.After(a.timeMultiplications)
-		return arg1 * arg2, a.timeMultiplications
-	default:
-		<-time.After(a.timeDivisions)
-		return arg1 / arg2, a.timeDivisions
+		return arg1 * arg2, nil
+	case "/":
+		if arg2 == 0 {
+			return 0, errDivisionByZero
+		}
+		return arg1 / arg2, nil
+	case "^":
+		if arg1 == 0 && arg2 < 0 {
+			return 0, errDivisionByZero
+		}
+		res := math.Pow(arg1, arg2)
+		if math.IsNaN(res) {
+			return 0, errors.New("fractional power of a negative number")
+		}
+		if math.IsInf(res, 0) {
+			return 0, errPowerTooLarge
+		}
+		return res, nil
+	case "%", "//":
+		if arg2 == 0 {
+			return 0, errDivisionByZero
+		}
+		if isInteger(arg1) && isInteger(arg2) {
+			return float64(integerDivision(int64(arg1), int64(arg2), oper)), nil
+		}
+		quo := math.Floor(arg1 / arg2)
+		if oper == "//" {
+			return quo, nil
+		}
+		return arg1 - arg2*quo, nil
+	case "sqrt":
+		if arg1 < 0 {
+			return 0, errors.New("square root of a negative number")
+		}
+		return math.Sqrt(arg1), nil
+	case "abs":
+		return math.Abs(arg1), nil
+	case "round":
+		return math.Round(arg1), nil
+	case "log":
+		if arg1 <= 0 {
+			return 0, errors.New("logarithm of a non-positive number")
+		}
+		return math.Log(arg1), nil
+	case "sin":
+		return math.Sin(arg1), nil
+	case "cos":
+		return math.Cos(arg1), nil
+	case "min":
+		return math.Min(arg1, arg2), nil
+	case "max":
+		return math.Max(arg1, arg2), nil
+	case "<":
+		return boolean(arg1 < arg2), nil
+	case "<=":
+		return boolean(arg1 <= arg2), nil
+	case ">":
+		return boolean(arg1 > arg2), nil
+	case ">=":
+		return boolean(arg1 >= arg2), nil
+	case "==":
+		return boolean(arg1 == arg2), nil
+	case "!=":
+		return boolean(arg1 != arg2), nil
+	case "and":
+		return boolean(arg1 != 0 && arg2 != 0), nil
+	case "or":
+		return boolean(arg1 != 0 || arg2 != 0), nil
+	case "not":
+		return boolean(arg1 == 0), nil
+	case "if":
+		// the orchestrator puts the result of the chosen branch in the first argument
+		return arg1, nil
+	case "&", "|", "<<", ">>":
+		if !isInteger(arg1) || !isInteger(arg2) {
+			return 0, errNotInteger
+		}
+		return bitwise(int64(arg1), int64(arg2), oper)
+	case "!":
+		// the product of the integers from arg2+1 to arg1, it is arg1! when arg2 is zero
+		if !isInteger(arg1) || !isInteger(arg2) || arg2 < 0 || arg1 < arg2 {
+			return 0, errFactorial
+		}
+		res := 1.0
+		for i := arg2 + 1; i <= arg1 && !math.IsInf(res, 0); i++ {
+			res *= i
+		}
+		if math.IsInf(res, 0) {
+			return 0, errors.New("factorial is too large")
+		}
+		return res, nil
+	}
+	return 0, errors.New("unknown operation: " + oper)
+}
+
+var (
+	errDivisionByZero = errors.New("division by zero")
+	errNotInteger     = errors.New("bitwise operation requires integer arguments")
+	errShift          = errors.New("shift count must be from 0 to 63")
+	errFactorial      = errors.New("factorial of a negative or non-integer number")
+	errPowerTooLarge  = errors.New("power is too large")
+	errTooLarge       = errors.New("result is too large")
+	errNotNumber      = errors.New("result is not a number")
+)
+
+// bitwise computes a bitwise operation on integers in two's complement. The left shift
+// is a multiplication by a power of two, so it doesn't overflow int64, the right shift rounds down.
+func bitwise(a, b int64, oper string) (float64, error) {
+	switch oper {
+	case "&":
+		return float64(a & b), nil
+	case "|":
+		return float64(a | b), nil
+	}
+	if b < 0 || b > 63 {
+		return 0, errShift
+	}
+	if oper == "<<" {
+		return math.Ldexp(float64(a), int(b)), nil
+	}
+	return float64(a >> b), nil
+}
+
+// boolean converts the result of a comparison or a logical operation into a number.
+func boolean(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// isInteger reports whether x is a whole number that fits in int64.
+func isInteger(x float64) bool {
+	return x == math.Trunc(x) && math.Abs(x) < 1<<63
+}
+
+// integerDivision computes the quotient or the remainder of the division rounded toward negative infinity,
+// so that a == (a // b) * b + a % b and the remainder has the sign of the divisor.
+func integerDivision(a, b int64, oper string) int64 {
+	quo, rem := a/b, a%b
+	if rem != 0 && (rem < 0) != (b < 0) {
+		quo--
+		rem += b
+	}
+	if oper == "//" {
+		return quo
 	}
+	return rem
 }
@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOperate(t *testing.T) {
+	testOperateCases := []struct {
+		name           string
+		arg1, arg2     float64
+		oper           string
+		expectedResult float64
+		expectedError  string
+	}{
+		{name: "operate: addition", arg1: 2, arg2: 3, oper: "+", expectedResult: 5},
+		{name: "operate: division", arg1: 7, arg2: 2, oper: "/", expectedResult: 3.5},
+		{name: "operate: division by zero", arg1: 7, arg2: 0, oper: "/", expectedError: errDivisionByZero.Error()},
+		{name: "operate: power", arg1: 2, arg2: 10, oper: "^", expectedResult: 1024},
+		{name: "operate: negative power of zero", arg1: 0, arg2: -1, oper: "^", expectedError: errDivisionByZero.Error()},
+		{name: "operate: fractional power of negative number", arg1: -8, arg2: 1.0 / 3, oper: "^", expectedError: "fractional power of a negative number"},
+		{name: "operate: power too large", arg1: 10, arg2: 400, oper: "^", expectedError: errPowerTooLarge.Error()},
+		{name: "operate: remainder has the sign of the divisor", arg1: -7, arg2: 3, oper: "%", expectedResult: 2},
+		{name: "operate: remainder of negative divisor", arg1: 7, arg2: -3, oper: "%", expectedResult: -2},
+		{name: "operate: remainder of fractions", arg1: 7.5, arg2: 2, oper: "%", expectedResult: 1.5},
+		{name: "operate: integer division rounds down", arg1: -7, arg2: 2, oper: "//", expectedResult: -4},
+		{name: "operate: remainder by zero", arg1: 7, arg2: 0, oper: "%", expectedError: errDivisionByZero.Error()},
+		{name: "operate: left shift", arg1: 1, arg2: 3, oper: "<<", expectedResult: 8},
+		{name: "operate: right shift rounds down", arg1: -7, arg2: 1, oper: ">>", expectedResult: -4},
+		{name: "operate: shift out of range", arg1: 1, arg2: 64, oper: "<<", expectedError: errShift.Error()},
+		{name: "operate: negative shift", arg1: 1, arg2: -1, oper: ">>", expectedError: errShift.Error()},
+		{name: "operate: bitwise of fraction", arg1: 2.5, arg2: 1, oper: "&", expectedError: errNotInteger.Error()},
+		{name: "operate: bitwise of negative numbers", arg1: -1, arg2: 6, oper: "&", expectedResult: 6},
+		{name: "operate: factorial", arg1: 5, arg2: 0, oper: "!", expectedResult: 120},
+		{name: "operate: partial factorial", arg1: 5, arg2: 2, oper: "!", expectedResult: 60},
+		{name: "operate: factorial of negative number", arg1: -1, arg2: 0, oper: "!", expectedError: errFactorial.Error()},
+		{name: "operate: factorial of fraction", arg1: 2.5, arg2: 0, oper: "!", expectedError: errFactorial.Error()},
+		{name: "operate: factorial too large", arg1: 171, arg2: 0, oper: "!", expectedError: "factorial is too large"},
+		{name: "operate: square root of negative number", arg1: -1, oper: "sqrt", expectedError: "square root of a negative number"},
+		{name: "operate: logarithm of zero", arg1: 0, oper: "log", expectedError: "logarithm of a non-positive number"},
+		{name: "operate: comparison", arg1: 1, arg2: 2, oper: "<=", expectedResult: 1},
+		{name: "operate: unknown operation", arg1: 1, arg2: 2, oper: "?", expectedError: "unknown operation: ?"},
+	}
+
+	for _, ts := range testOperateCases {
+		t.Run(ts.name, func(t *testing.T) {
+			res, err := operate(ts.arg1, ts.arg2, ts.oper)
+			if ts.expectedError != "" {
+				if err == nil || err.Error() != ts.expectedError {
+					t.Errorf("invalid error, got: %v, want: %s", err, ts.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if res != ts.expectedResult {
+				t.Errorf("invalid result, got: %v, want: %v", res, ts.expectedResult)
+			}
+		})
+	}
+}
+
+func TestCalculateNotFinite(t *testing.T) {
+	testNotFiniteCases := []struct {
+		name          string
+		arg1, arg2    float64
+		oper          string
+		expectedError string
+	}{
+		{name: "calculate: overflow of multiplication", arg1: 1e308, arg2: 10, oper: "*", expectedError: errTooLarge.Error()},
+		{name: "calculate: overflow of subtraction", arg1: -1e308, arg2: 1e308, oper: "-", expectedError: errTooLarge.Error()},
+		{name: "calculate: not a number", arg1: math.Inf(1), arg2: math.Inf(1), oper: "-", expectedError: errNotNumber.Error()},
+	}
+
+	for _, ts := range testNotFiniteCases {
+		t.Run(ts.name, func(t *testing.T) {
+			if _, err := calculate(ts.arg1, ts.arg2, ts.oper); err == nil || err.Error() != ts.expectedError {
+				t.Errorf("invalid error, got: %v, want: %s", err, ts.expectedError)
+			}
+		})
+	}
+}
+
+func TestCalculateExact(t *testing.T) {
+	testExactCases := []struct {
+		name           string
+		arg1, arg2     string
+		oper           string
+		expectedResult string
+		expectedError  string
+	}{
+		{name: "exact: addition of fractions", arg1: "1/3", arg2: "1/6", oper: "+", expectedResult: "1/2"},
+		{name: "exact: division", arg1: "1", arg2: "3", oper: "/", expectedResult: "1/3"},
+		{name: "exact: division by zero", arg1: "1", arg2: "0", oper: "/", expectedError: errDivisionByZero.Error()},
+		{name: "exact: negative power", arg1: "2/3", arg2: "-2", oper: "^", expectedResult: "9/4"},
+		{name: "exact: negative power of zero", arg1: "0", arg2: "-1", oper: "^", expectedError: errDivisionByZero.Error()},
+		{name: "exact: fractional exponent", arg1: "4", arg2: "1/2", oper: "^", expectedError: "exact power requires an integer exponent"},
+		{name: "exact: exponent too large", arg1: "1", arg2: "10001", oper: "^", expectedError: "exponent is too large"},
+		{name: "exact: power of too many bits", arg1: "1" + zeros(1000), arg2: "1000", oper: "^", expectedError: errPowerTooLarge.Error()},
+		{name: "exact: power of one", arg1: "1", arg2: "10000", oper: "^", expectedResult: "1"},
+		{name: "exact: remainder has the sign of the divisor", arg1: "-7", arg2: "3", oper: "%", expectedResult: "2"},
+		{name: "exact: integer division of fractions", arg1: "7/2", arg2: "1", oper: "//", expectedResult: "3"},
+		{name: "exact: remainder by zero", arg1: "7", arg2: "0", oper: "%", expectedError: errDivisionByZero.Error()},
+		{name: "exact: round half away from zero", arg1: "-5/2", oper: "round", expectedResult: "-3"},
+		{name: "exact: left shift beyond 64 bits", arg1: "1", arg2: "70", oper: "<<", expectedResult: "1180591620717411303424"},
+		{name: "exact: shift out of range", arg1: "1", arg2: "10001", oper: "<<", expectedError: "shift count must be from 0 to 10000"},
+		{name: "exact: bitwise of fraction", arg1: "1/2", arg2: "1", oper: "|", expectedError: errNotInteger.Error()},
+		{name: "exact: factorial", arg1: "10", arg2: "0", oper: "!", expectedResult: "3628800"},
+		{name: "exact: partial factorial", arg1: "10", arg2: "7", oper: "!", expectedResult: "720"},
+		{name: "exact: factorial of negative number", arg1: "-1", arg2: "0", oper: "!", expectedError: errFactorial.Error()},
+		{name: "exact: factorial too large", arg1: "10001", arg2: "0", oper: "!", expectedError: "factorial is too large"},
+		{name: "exact: comparison", arg1: "1/3", arg2: "1/2", oper: "<", expectedResult: "1"},
+		{name: "exact: square root", arg1: "4", oper: "sqrt", expectedError: "operation can't be computed exactly: sqrt"},
+		{name: "exact: invalid argument", arg1: "x", arg2: "1", oper: "+", expectedError: "invalid exact argument: x"},
+	}
+
+	for _, ts := range testExactCases {
+		t.Run(ts.name, func(t *testing.T) {
+			res, err := calculateExact(ts.arg1, ts.arg2, ts.oper)
+			if ts.expectedError != "" {
+				if err == nil || err.Error() != ts.expectedError {
+					t.Errorf("invalid error, got: %v, want: %s", err, ts.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := res.RatString(); got != ts.expectedResult {
+				t.Errorf("invalid result, got: %s, want: %s", got, ts.expectedResult)
+			}
+		})
+	}
+}
+
+func TestCalculateComplex(t *testing.T) {
+	testComplexCases := []struct {
+		name           string
+		arg1, arg2     complex128
+		oper           string
+		expectedResult complex128
+		expectedError  string
+	}{
+		{name: "complex: multiplication", arg1: 1 + 2i, arg2: 3 - 1i, oper: "*", expectedResult: 5 + 5i},
+		{name: "complex: division", arg1: 4 + 2i, arg2: 2i, oper: "/", expectedResult: 1 - 2i},
+		{name: "complex: division by zero", arg1: 1i, arg2: 0, oper: "/", expectedError: errDivisionByZero.Error()},
+		{name: "complex: square root of negative number", arg1: -4, oper: "sqrt", expectedResult: 2i},
+		{name: "complex: power of real numbers is exact", arg1: -2, arg2: 3, oper: "^", expectedResult: -8},
+		{name: "complex: negative power of zero", arg1: 0, arg2: -1, oper: "^", expectedError: errDivisionByZero.Error()},
+		{name: "complex: power too large", arg1: 2 + 1i, arg2: 2000, oper: "^", expectedError: errPowerTooLarge.Error()},
+		{name: "complex: overflow of multiplication", arg1: 1e308 + 1e308i, arg2: 10, oper: "*", expectedError: errTooLarge.Error()},
+		{name: "complex: logarithm of zero", arg1: 0, oper: "log", expectedError: "logarithm of zero"},
+		{name: "complex: round of both parts", arg1: 1.5 - 2.5i, oper: "round", expectedResult: 2 - 3i},
+		{name: "complex: equality", arg1: 1 + 1i, arg2: 1 + 1i, oper: "==", expectedResult: 1},
+		{name: "complex: remainder of real numbers", arg1: 7, arg2: -3, oper: "%", expectedResult: -2},
+		{name: "complex: remainder of imaginary numbers", arg1: 7i, arg2: 3, oper: "%", expectedError: "operation % requires real arguments"},
+		{name: "complex: shift of real numbers", arg1: 1, arg2: 64, oper: "<<", expectedError: errShift.Error()},
+	}
+
+	for _, ts := range testComplexCases {
+		t.Run(ts.name, func(t *testing.T) {
+			res, err := calculateComplex(ts.arg1, ts.arg2, ts.oper)
+			if ts.expectedError != "" {
+				if err == nil || err.Error() != ts.expectedError {
+					t.Errorf("invalid error, got: %v, want: %s", err, ts.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if res != ts.expectedResult {
+				t.Errorf("invalid result, got: %v, want: %v", res, ts.expectedResult)
+			}
+		})
+	}
+}
+
+func zeros(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = '0'
+	}
+	return string(b)
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+)
+
+// calculateComplex computes the operation with complex numbers and, as calculate,
+// fails if a part of the result isn't a finite number.
+func calculateComplex(x, y complex128, oper string) (complex128, error) {
+	res, err := operateComplex(x, y, oper)
+	if err != nil {
+		return 0, err
+	}
+	if cmplx.IsInf(res) {
+		return 0, errTooLarge
+	}
+	if cmplx.IsNaN(res) {
+		return 0, errNotNumber
+	}
+	return res, nil
+}
+
+// operateComplex computes the operation with complex numbers. Operations that make sense
+// only for real numbers, such as % or max, require arguments without imaginary parts.
+func operateComplex(x, y complex128, oper string) (complex128, error) {
+	switch oper {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return 0, errDivisionByZero
+		}
+		return x / y, nil
+	case "^":
+		if x == 0 && real(y) < 0 {
+			return 0, errDivisionByZero
+		}
+		res := cmplx.Pow(x, y)
+		if imag(x) == 0 && imag(y) == 0 && (real(x) >= 0 || real(y) == math.Trunc(real(y))) {
+			// powers of real numbers stay exact, cmplx.Pow would add a tiny imaginary part
+			res = complex(math.Pow(real(x), real(y)), 0)
+		}
+		if cmplx.IsInf(res) {
+			return 0, errPowerTooLarge
+		}
+		return res, nil
+	case "sqrt":
+		return cmplx.Sqrt(x), nil
+	case "abs":
+		return complex(cmplx.Abs(x), 0), nil
+	case "log":
+		if x == 0 {
+			return 0, errors.New("logarithm of zero")
+		}
+		return cmplx.Log(x), nil
+	case "sin":
+		return cmplx.Sin(x), nil
+	case "cos":
+		return cmplx.Cos(x), nil
+	case "==", "!=":
+		return complex(boolean((x == y) == (oper == "==")), 0), nil
+	case "if":
+		return x, nil
+	case "round":
+		return complex(math.Round(real(x)), math.Round(imag(x))), nil
+	}
+	if imag(x) != 0 || imag(y) != 0 {
+		return 0, errors.New("operation " + oper + " requires real arguments")
+	}
+	res, err := calculate(real(x), real(y), oper)
+	return complex(res, 0), err
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+)
+
+// maxExponent limits the exponent of an exact power, so that the numbers stay of a reasonable size.
+const maxExponent = 10000
+
+// maxPowerBits limits the size of an exact power, so that chains of powers such as (10^10000)^10000
+// don't grow the numbers without bound, it is about 300000 decimal digits.
+const maxPowerBits = 1 << 20
+
+// maxFactorial limits the argument of an exact factorial as the parser does.
+const maxFactorial = 10000
+
+// calculateExact computes the operation with fractions, the arguments and the result
+// are represented as strings in the form "a/b" or "a".
+func calculateExact(arg1, arg2, oper string) (*big.Rat, error) {
+	x, ok := new(big.Rat).SetString(arg1)
+	if !ok {
+		return nil, errors.New("invalid exact argument: " + arg1)
+	}
+	y := new(big.Rat)
+	if arg2 != "" {
+		if _, ok := y.SetString(arg2); !ok {
+			return nil, errors.New("invalid exact argument: " + arg2)
+		}
+	}
+
+	switch oper {
+	case "+":
+		return x.Add(x, y), nil
+	case "-":
+		return x.Sub(x, y), nil
+	case "*":
+		return x.Mul(x, y), nil
+	case "/":
+		if y.Sign() == 0 {
+			return nil, errDivisionByZero
+		}
+		return x.Quo(x, y), nil
+	case "^":
+		return exactPower(x, y)
+	case "%", "//":
+		if y.Sign() == 0 {
+			return nil, errDivisionByZero
+		}
+		quo := floor(new(big.Rat).Quo(x, y))
+		if oper == "//" {
+			return new(big.Rat).SetInt(quo), nil
+		}
+		return x.Sub(x, new(big.Rat).Mul(y, new(big.Rat).SetInt(quo))), nil
+	case "abs":
+		return x.Abs(x), nil
+	case "round":
+		// halves are rounded away from zero as math.Round does
+		res := new(big.Rat).SetInt(floor(new(big.Rat).Add(new(big.Rat).Abs(x), big.NewRat(1, 2))))
+		if x.Sign() < 0 {
+			res.Neg(res)
+		}
+		return res, nil
+	case "min":
+		if x.Cmp(y) <= 0 {
+			return x, nil
+		}
+		return y, nil
+	case "max":
+		if x.Cmp(y) >= 0 {
+			return x, nil
+		}
+		return y, nil
+	case "<", "<=", ">", ">=", "==", "!=":
+		// x compares with y as the sign of x-y compares with zero
+		res, err := calculate(float64(x.Cmp(y)), 0, oper)
+		return new(big.Rat).SetFloat64(res), err
+	case "and", "or", "not":
+		res, err := calculate(float64(x.Sign()), float64(y.Sign()), oper)
+		return new(big.Rat).SetFloat64(res), err
+	case "if":
+		return x, nil
+	case "&", "|", "<<", ">>":
+		if !x.IsInt() || !y.IsInt() {
+			return nil, errNotInteger
+		}
+		return exactBitwise(x.Num(), y.Num(), oper)
+	case "!":
+		if !x.IsInt() || !y.IsInt() || y.Sign() < 0 || x.Cmp(y) < 0 {
+			return nil, errFactorial
+		}
+		if x.Num().Cmp(big.NewInt(maxFactorial)) > 0 {
+			return nil, errors.New("factorial is too large")
+		}
+		return new(big.Rat).SetInt(new(big.Int).MulRange(y.Num().Int64()+1, x.Num().Int64())), nil
+	}
+	return nil, errors.New("operation can't be computed exactly: " + oper)
+}
+
+// floor returns the largest integer less than or equal to x,
+// the Euclidean division rounds down because the denominator is always positive.
+func floor(x *big.Rat) *big.Int {
+	return new(big.Int).Div(x.Num(), x.Denom())
+}
+
+// exactPower raises x to the integer power y.
+func exactPower(x, y *big.Rat) (*big.Rat, error) {
+	if !y.IsInt() {
+		return nil, errors.New("exact power requires an integer exponent")
+	}
+	if !y.Num().IsInt64() || y.Num().Int64() > maxExponent || y.Num().Int64() < -maxExponent {
+		return nil, errors.New("exponent is too large")
+	}
+	exp := y.Num().Int64()
+	if x.Sign() == 0 && exp < 0 {
+		return nil, errDivisionByZero
+	}
+	neg := exp < 0
+	if neg {
+		exp = -exp
+	}
+	// the bit length of the result is at most the bit length of the base times the exponent
+	bits := int64(max(x.Num().BitLen(), x.Denom().BitLen()))
+	if bits*exp > maxPowerBits {
+		return nil, errPowerTooLarge
+	}
+	e := big.NewInt(exp)
+	num := new(big.Int).Exp(x.Num(), e, nil)
+	den := new(big.Int).Exp(x.Denom(), e, nil)
+	if neg {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// exactBitwise is bitwise for integers of any size, negative numbers behave as in two's complement.
+func exactBitwise(a, b *big.Int, oper string) (*big.Rat, error) {
+	res := new(big.Int)
+	switch oper {
+	case "&":
+		res.And(a, b)
+	case "|":
+		res.Or(a, b)
+	default:
+		if !b.IsInt64() || b.Sign() < 0 || b.Int64() > maxExponent {
+			return nil, errors.New("shift count must be from 0 to " + strconv.Itoa(maxExponent))
+		}
+		if oper == "<<" {
+			res.Lsh(a, uint(b.Int64()))
+		} else {
+			res.Rsh(a, uint(b.Int64()))
+		}
+	}
+	return new(big.Rat).SetInt(res), nil
+}
@@ -0,0 +1,214 @@
+package orchestrator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+)
+
+// elements plans the elements of a vector or a matrix in row-major order, every element
+// is computed by its own tasks. A number is a single element, so it is applied to each
+// element of the other operand of arithmetic.
+func (p *planner) elements(n expr.Node) ([]operand, error) {
+	shape, err := expr.Shape(n, p.shapes)
+	if err != nil {
+		return nil, err
+	}
+	if shape == nil {
+		x, err := p.node(n)
+		if err != nil {
+			return nil, err
+		}
+		return []operand{x}, nil
+	}
+
+	switch n := n.(type) {
+	case *expr.Ident:
+		return p.arrays[n.Name], nil
+	case *expr.Array:
+		var elems []operand
+		for _, e := range n.Elems {
+			row, err := p.elements(e)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, row...)
+		}
+		return elems, nil
+	case *expr.Unary:
+		xs, err := p.elements(n.X)
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]operand, len(xs))
+		for i, x := range xs {
+			if elems[i], err = p.unary(n, x); err != nil {
+				return nil, err
+			}
+		}
+		return elems, nil
+	case *expr.Binary:
+		xs, err := p.elements(n.X)
+		if err != nil {
+			return nil, err
+		}
+		ys, err := p.elements(n.Y)
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]operand, max(len(xs), len(ys)))
+		for i := range elems {
+			if elems[i], err = p.binary(n, xs[min(i, len(xs)-1)], ys[min(i, len(ys)-1)]); err != nil {
+				return nil, err
+			}
+		}
+		return elems, nil
+	case *expr.Call:
+		xs, err := p.elements(n.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		if n.Func == "transpose" {
+			// transposition only rearranges the elements, it has no tasks
+			rows, cols := shape[1], shape[0]
+			elems := make([]operand, len(xs))
+			for i := range rows {
+				for j := range cols {
+					elems[j*rows+i] = xs[i*cols+j]
+				}
+			}
+			return elems, nil
+		}
+		if _, err := p.function(n); err != nil {
+			return nil, err
+		}
+		elems := make([]operand, len(xs))
+		for i, x := range xs {
+			elems[i] = p.add(n.Func, x, operand{})
+		}
+		return elems, nil
+	}
+	return nil, fmt.Errorf("unknown array node %T", n)
+}
+
+// dot plans the products of the elements of two vectors and their sum.
+func (p *planner) dot(n *expr.Call) (operand, error) {
+	xs, err := p.elements(n.Args[0])
+	if err != nil {
+		return operand{}, err
+	}
+	ys, err := p.elements(n.Args[1])
+	if err != nil {
+		return operand{}, err
+	}
+	products := make([]operand, len(xs))
+	for i := range xs {
+		products[i] = p.add("*", xs[i], ys[i])
+	}
+	return reduce("+", products, p.add), nil
+}
+
+// determinant plans the cofactor expansion of a square matrix along its first row.
+// A minor depends only on the columns that are left in it, so each minor is planned once
+// and the number of tasks is about n*2^n instead of n!. The terms with the same sign
+// are added by pairs and the sums are subtracted, so that the tasks can run in parallel.
+func (p *planner) determinant(n *expr.Call) (operand, error) {
+	a, err := p.elements(n.Args[0])
+	if err != nil {
+		return operand{}, err
+	}
+	size := 1
+	for size*size < len(a) {
+		size++
+	}
+
+	minors := make(map[uint]operand)
+	var minor func(cols uint) operand
+	minor = func(cols uint) operand {
+		row := size - bits.OnesCount(cols)
+		if row == size-1 {
+			return a[row*size+bits.TrailingZeros(cols)]
+		}
+		if m, ok := minors[cols]; ok {
+			return m
+		}
+		var terms [2][]operand
+		k := 0
+		for j := range size {
+			if cols&(1<<j) == 0 {
+				continue
+			}
+			terms[k%2] = append(terms[k%2], p.add("*", a[row*size+j], minor(cols&^(1<<j))))
+			k++
+		}
+		m := reduce("+", terms[0], p.add)
+		if len(terms[1]) > 0 {
+			m = p.add("-", m, reduce("+", terms[1], p.add))
+		}
+		minors[cols] = m
+		return m
+	}
+	return minor(1<<size - 1), nil
+}
+
+// storeValue assembles the vector or the matrix of a calculated expression from its elements
+// and saves it as JSON. An element is a number, a fraction string in the exact mode and
+// an object with the re and im parts in the complex mode. An expression without a shape is left as is.
+func storeValue(tx *sql.Tx, login string, id_expression int64) error {
+	var text sql.NullString
+	var precision string
+	err := tx.QueryRow("SELECT shape, precision FROM expressions WHERE login = $1 AND id_expression = $2", login, id_expression).Scan(&text, &precision)
+	if err != nil || !text.Valid {
+		return err
+	}
+	var shape []int
+	if err := json.Unmarshal([]byte(text.String), &shape); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT COALESCE(t.result, e.result, 0), COALESCE(t.imag_result, e.imag_result, 0), COALESCE(t.exact_result, e.exact_result, '')
+		FROM elements AS e LEFT JOIN tasks AS t ON t.login = e.login AND t.id_expression = e.id_expression AND t.id_task = e.id_task
+		WHERE e.login = $1 AND e.id_expression = $2 ORDER BY e.position`, login, id_expression)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var elems []any
+	for rows.Next() {
+		var value, imag float64
+		var exact string
+		if err := rows.Scan(&value, &imag, &exact); err != nil {
+			return err
+		}
+		switch precision {
+		case "exact":
+			elems = append(elems, exact)
+		case "complex":
+			elems = append(elems, map[string]float64{"re": value, "im": imag})
+		default:
+			elems = append(elems, value)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var value any = elems
+	if len(shape) == 2 {
+		matrix := make([][]any, shape[0])
+		for i := range matrix {
+			matrix[i] = elems[i*shape[1] : (i+1)*shape[1]]
+		}
+		value = matrix
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE expressions SET value = $1 WHERE login = $2 AND id_expression = $3", string(data), login, id_expression)
+	return err
+}
@@ -0,0 +1,73 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
+)
+
+// GET /api/v1/format?expression=...
+//
+// The expression or the script is only parsed, the canonical form is returned without scheduling tasks.
+func (o *Orchestrator) Format(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.Format"
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	implicit, ok := implicitQuery(w, r, op)
+	if !ok {
+		return
+	}
+
+	tx, _ := o.db.Begin()
+	defer tx.Rollback()
+
+	funcs, err := userFunctions(tx, login)
+	if err != nil {
+		log.Printf("%s: error while retrieving the functions from the database, error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := expr.Options{ImplicitMultiplication: implicit, Functions: funcs}
+	stmts, err := expr.ParseScript(query.Get("expression"), opts)
+	if err != nil {
+		log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+		expressionError(w, err)
+		return
+	}
+
+	resp := models.FormatResponse{Canonical: expr.FormatScript(stmts)}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrServer)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: canonical form of %s for the login %s is %s\n", op, query.Get("expression"), login, resp.Canonical)
+}
+
+// implicitQuery returns the query parameter implicit_multiplication, it is parsed as dry_run is
+// and an invalid value is answered with 422.
+func implicitQuery(w http.ResponseWriter, r *http.Request, op string) (bool, bool) {
+	s := r.URL.Query().Get("implicit_multiplication")
+	if s == "" {
+		return false, true
+	}
+	implicit, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Printf("%s: %s: %s\n", op, errs.ErrImplicit, s)
+		http.Error(w, errs.ErrImplicit.Error(), http.StatusUnprocessableEntity)
+		return false, false
+	}
+	return implicit, true
+}
@@ -0,0 +1,94 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
+)
+
+// POST /api/v1/derivative
+func (o *Orchestrator) Derivative(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.Derivative"
+
+	var dreq models.DerivativeRequest
+	if err := json.NewDecoder(r.Body).Decode(&dreq); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrRequestJSON)
+		http.Error(w, errs.ErrRequestJSON.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	if !expr.IsName(dreq.Variable) {
+		log.Printf("%s: %s: %s\n", op, errs.ErrVariableName, dreq.Variable)
+		http.Error(w, errs.ErrVariableName.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	precision, ok := precisionOf(dreq.Precision)
+	if !ok {
+		log.Printf("%s: %s: %s\n", op, errs.ErrPrecision, dreq.Precision)
+		http.Error(w, errs.ErrPrecision.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	tx, _ := o.db.Begin()
+	defer tx.Rollback()
+
+	funcs, err := userFunctions(tx, login)
+	if err != nil {
+		log.Printf("%s: error while retrieving the functions from the database, error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tree, err := expr.ParseWith(dreq.Expression, expr.Options{Functions: funcs})
+	if err == nil {
+		tree, err = expr.Inline(tree, funcs)
+	}
+	if err == nil {
+		tree, err = expr.Derivative(tree, dreq.Variable)
+	}
+	if err != nil {
+		log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+		expressionError(w, err)
+		return
+	}
+	// numbers are folded only in floats, so that the derivative can still be computed exactly
+	tree = expr.SimplifySymbolic(tree, precision == "float")
+	resp := models.DerivativeResponse{Derivative: expr.Format(tree)}
+
+	status := http.StatusOK
+	if dreq.At != nil {
+		// the point is bound to the variable as the first statement of a script
+		at := strconv.FormatFloat(*dreq.At, 'g', -1, 64)
+		stmts := []expr.Statement{{Name: dreq.Variable, X: &expr.Number{Value: *dreq.At, Text: at}}, {X: tree}}
+		if resp.Id, ok = submit(w, tx, op, login, expr.FormatScript(stmts), precision, stmts, nil, false); !ok {
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			log.Printf("%s: transaction capture error: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusCreated
+	}
+
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrServer)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: derivative of %s by %s for the login %s is %s\n", op, dreq.Expression, dreq.Variable, login, resp.Derivative)
+}
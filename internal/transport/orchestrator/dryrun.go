@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
+)
+
+// dryRun plans the expression like submit and returns the planned tasks, their dependencies and
+// the estimated time, nothing is written to the database and the number of expressions isn't changed.
+func (o *Orchestrator) dryRun(w http.ResponseWriter, tx *sql.Tx, op, login, expression, precision string, tree expr.Node, funcs map[string]*expr.Definition, simplify bool) {
+	c, ok := compose(w, tx, op, login, precision, []expr.Statement{{X: tree}}, funcs, simplify)
+	if !ok {
+		return
+	}
+
+	resp := models.DryRunResponse{Precision: c.precision, Tasks: make([]models.PlannedTask, len(c.tasks)), Edges: make([][2]int, 0), TasksSaved: c.saved}
+	// ids of tasks start from 1 and the dependencies of a task are planned before it,
+	// so the time when a task is finished is known for all its dependencies
+	finished := make([]time.Duration, len(c.tasks)+1)
+	var total time.Duration
+	for i, t := range c.tasks {
+		duration := o.durations[t.operation]
+		resp.Tasks[i] = models.PlannedTask{Id: t.id, Operation: t.operation, Arg1: planArgument(t.arg1, c.precision), Arg2: planArgument(t.arg2, c.precision), Condition: t.cond, Branch: t.branch, TimeMs: duration.Milliseconds()}
+
+		var start time.Duration
+		for _, dep := range []int{t.arg1.task, t.arg2.task, t.cond} {
+			if dep == 0 {
+				continue
+			}
+			resp.Edges = append(resp.Edges, [2]int{dep, t.id})
+			start = max(start, finished[dep])
+		}
+		finished[t.id] = start + duration
+		total += duration
+		resp.EstimatedTimeMs = max(resp.EstimatedTimeMs, finished[t.id].Milliseconds())
+	}
+	resp.TotalTimeMs = total.Milliseconds()
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrServer)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: expression %s for the login %s was planned into %d tasks without saving\n", op, expression, login, len(c.tasks))
+}
+
+// planArgument is an argument of a planned task as it is saved: null for the result of another task,
+// a string of a fraction in the exact mode and {"re","im"} for a complex number.
+func planArgument(o operand, precision string) any {
+	switch {
+	case o.task != 0:
+		return nil
+	case o.exact != "":
+		return o.exact
+	case precision == "complex":
+		return map[string]float64{"re": o.value, "im": o.imag}
+	}
+	return o.value
+}
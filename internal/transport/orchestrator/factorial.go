@@ -0,0 +1,58 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+)
+
+// factorialChunk is the number of factors in a partial product of a factorial.
+const factorialChunk = 25
+
+// maxFloatFactorial is the largest factorial that is a finite float64.
+const maxFloatFactorial = 170
+
+// factorial plans n! as the task "!" whose arguments are n and k, it computes the product
+// of the integers from k+1 to n. The factorial of a number is split into partial products
+// of factorialChunk factors, they are computed at the same time and multiplied by pairs.
+// The argument computed by a task is checked by the agent.
+func (p *planner) factorial(n *expr.Unary, x operand) (operand, error) {
+	if x.task != 0 {
+		return p.add("!", x, p.literal(0)), nil
+	}
+
+	num := &expr.Number{Value: x.value, Imag: x.imag != 0, Text: fmt.Sprint(x.value), Position: n.X.Pos()}
+	if x.imag != 0 {
+		num.Text = fmt.Sprint(x.imag) + expr.Imaginary
+	}
+	if err := expr.CheckFactorial(num); err != nil {
+		return operand{}, err
+	}
+	if !p.exact && x.value > maxFloatFactorial {
+		return operand{}, &expr.Error{Code: expr.CodeInvalidFactorial, Pos: n.Pos(), Msg: fmt.Sprintf("factorial of %v is too large for floats, use the exact mode", x.value)}
+	}
+
+	var products []operand
+	for k := int64(0); k < int64(x.value); k += factorialChunk {
+		products = append(products, p.add("!", p.literal(min(k+factorialChunk, int64(x.value))), p.literal(k)))
+	}
+	if len(products) == 0 {
+		// 0! is 1
+		return p.literal(1), nil
+	}
+	return reduce("*", products, p.add), nil
+}
+
+// percent divides the operand by 100, the percent of a number is computed at once.
+func (p *planner) percent(x operand) operand {
+	hundred := p.literal(100)
+	if x.task != 0 {
+		return p.add("/", x, hundred)
+	}
+	x.value, x.imag = x.value/100, x.imag/100
+	if r, ok := new(big.Rat).SetString(x.exact); ok {
+		x.exact = r.Quo(r, big.NewRat(100, 1)).RatString()
+	}
+	return x
+}
@@ -0,0 +1,203 @@
+package orchestrator
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+)
+
+// maxDenominator is the largest denominator of a fraction approximating a float result.
+var maxDenominator = big.NewInt(1_000_000_000)
+
+// fractionDigits is the number of digits after the point for fractions with an infinite decimal expansion.
+const fractionDigits = 30
+
+// Formats of the result of an expression, they are chosen by the query parameter format.
+const (
+	formatDecimal  = "decimal"
+	formatFraction = "fraction"
+	formatMixed    = "mixed"
+	formatLatex    = "latex"
+)
+
+// resultFormat returns the format of the result from the query parameter format,
+// the empty format means the default output.
+func resultFormat(format string) (string, bool) {
+	switch format {
+	case "", formatDecimal, formatFraction, formatMixed, formatLatex:
+		return format, true
+	}
+	return "", false
+}
+
+// resultQuery returns the format and the base of the result from the query parameters format and base,
+// an invalid parameter is answered with 422. The latex format renders the formulas of the expression
+// and its result in addition to the default output of the result, so tex is set and the format is empty.
+func resultQuery(w http.ResponseWriter, r *http.Request, op string) (format string, base int, tex bool, ok bool) {
+	query := r.URL.Query()
+	if format, ok = resultFormat(query.Get("format")); !ok {
+		log.Printf("%s: %s: %s\n", op, errs.ErrFormat, query.Get("format"))
+		http.Error(w, errs.ErrFormat.Error(), http.StatusUnprocessableEntity)
+		return "", 0, false, false
+	}
+	if format == formatLatex {
+		format, tex = "", true
+	}
+
+	if base, ok = resultBase(query.Get("base")); !ok {
+		log.Printf("%s: %s: %s\n", op, errs.ErrBase, query.Get("base"))
+		http.Error(w, errs.ErrBase.Error(), http.StatusUnprocessableEntity)
+		return "", 0, false, false
+	}
+	return format, base, tex, true
+}
+
+// formatResult renders the result of an expression in the format. The exact result is stored as a fraction,
+// for expressions computed with floats it is the simplest fraction equal to the result, see floatRat.
+// Both parts of a complex result are rendered, for example 1/2+3/4i.
+func formatResult(exact sql.NullString, result, imag float64, format string) (string, error) {
+	if !exact.Valid && format == "" {
+		return "", nil
+	}
+
+	r := floatRat(result)
+	if exact.Valid {
+		var ok bool
+		if r, ok = new(big.Rat).SetString(exact.String); !ok {
+			return "", errors.New("invalid exact result: " + exact.String)
+		}
+	}
+	if imag == 0 {
+		return formatRat(r, format), nil
+	}
+
+	s := formatRat(floatRat(math.Abs(imag)), format) + expr.Imaginary
+	switch {
+	case r.Sign() == 0 && imag < 0:
+		return "-" + s, nil
+	case r.Sign() == 0:
+		return s, nil
+	case imag < 0:
+		return formatRat(r, format) + "-" + s, nil
+	}
+	return formatRat(r, format) + "+" + s, nil
+}
+
+// formatRat renders a fraction in the format, the decimal is the default.
+func formatRat(r *big.Rat, format string) string {
+	switch format {
+	case formatFraction:
+		return r.RatString()
+	case formatMixed:
+		return mixedString(r)
+	}
+	return decimalString(r)
+}
+
+// floatRat returns the fraction with the smallest denominator up to maxDenominator that is rounded
+// to the float, so -2.3333333333333335 is -7/3. The convergents of the continued fraction of the float
+// are the best approximations, the first one rounded to the float is taken. A float without such a fraction
+// is taken from its shortest decimal representation, as well as a large float whose convergent is
+// the integer of its binary value, so 1e300 isn't printed with the digits of its binary error.
+func floatRat(f float64) *big.Rat {
+	x := new(big.Rat).SetFloat64(math.Abs(f))
+	if x == nil {
+		return new(big.Rat)
+	}
+	shortest, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	h, prevH := big.NewInt(1), big.NewInt(0)
+	k, prevK := big.NewInt(0), big.NewInt(1)
+	for {
+		a := new(big.Int).Quo(x.Num(), x.Denom())
+		h, prevH = new(big.Int).Add(new(big.Int).Mul(a, h), prevH), h
+		k, prevK = new(big.Int).Add(new(big.Int).Mul(a, k), prevK), k
+		if k.Cmp(maxDenominator) > 0 {
+			break
+		}
+		r := new(big.Rat).SetFrac(h, k)
+		if v, _ := r.Float64(); v == math.Abs(f) {
+			if f < 0 {
+				r.Neg(r)
+			}
+			if r.IsInt() && r.Cmp(shortest) != 0 {
+				break
+			}
+			return r
+		}
+		x.Sub(x, new(big.Rat).SetInt(a))
+		if x.Sign() == 0 {
+			break
+		}
+		x.Inv(x)
+	}
+	return shortest
+}
+
+// decimalString converts a fraction into a decimal string. The decimal is exact when the denominator
+// has no prime factors except 2 and 5, otherwise it is rounded to fractionDigits digits after the point.
+func decimalString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	if digits, ok := r.FloatPrec(); ok {
+		return r.FloatString(digits)
+	}
+	s := r.FloatString(fractionDigits)
+	return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+}
+
+// mixedString converts a fraction into a mixed number, e.g. -7/2 becomes "-3 1/2".
+func mixedString(r *big.Rat) string {
+	if r.IsInt() || r.Num().CmpAbs(r.Denom()) < 0 {
+		return r.RatString()
+	}
+	whole, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	return whole.String() + " " + rem.Abs(rem).String() + "/" + r.Denom().String()
+}
+
+// prefixes are the prefixes of integer literals in the bases of the query parameter base.
+var prefixes = map[int]string{2: "0b", 8: "0o", 10: "", 16: "0x"}
+
+// resultBase returns the base from the query parameter base, zero means that the base is not requested.
+func resultBase(base string) (int, bool) {
+	if base == "" {
+		return 0, true
+	}
+	b, err := strconv.Atoi(base)
+	if _, ok := prefixes[b]; err != nil || !ok {
+		return 0, false
+	}
+	return b, true
+}
+
+// baseResult renders an integer result in the base with the prefix of a literal, for example -0xff.
+// A result that isn't an integer or has an imaginary part has no representation in the base, so it is empty.
+func baseResult(exact sql.NullString, result, imag float64, base int) string {
+	if base == 0 || imag != 0 {
+		return ""
+	}
+	r := new(big.Rat)
+	if _, ok := r.SetString(exact.String); !exact.Valid || !ok {
+		if math.IsInf(result, 0) || math.IsNaN(result) {
+			return ""
+		}
+		r.SetFloat64(result)
+	}
+	if !r.IsInt() {
+		return ""
+	}
+	n := r.Num()
+	sign := ""
+	if n.Sign() < 0 {
+		sign = "-"
+	}
+	return sign + prefixes[base] + new(big.Int).Abs(n).Text(base)
+}
@@ -0,0 +1,136 @@
+package orchestrator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
+)
+
+// GET /api/v1/functions
+func (o *Orchestrator) Functions(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.Functions"
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	rows, err := o.db.Query("SELECT name, params, body FROM functions WHERE login = $1 ORDER BY name", login)
+	if err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	funcs := []models.Function{}
+	for rows.Next() {
+		var f models.Function
+		var params string
+		if err := rows.Scan(&f.Name, &params, &f.Body); err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return
+		}
+		f.Params = strings.Split(params, ",")
+		funcs = append(funcs, f)
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string][]models.Function{"functions": funcs}); err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: output of all functions for the login: %s\n", op, login)
+}
+
+// POST /api/v1/functions
+func (o *Orchestrator) AddFunction(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.AddFunction"
+
+	var freq models.FunctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&freq); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrRequestJSON)
+		http.Error(w, errs.ErrRequestJSON.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	tx, _ := o.db.Begin()
+	defer tx.Rollback()
+
+	funcs, err := userFunctions(tx, login)
+	if err != nil {
+		log.Printf("%s: error while retrieving the functions from the database, error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	def, err := expr.ParseDefinition(freq.Definition, funcs)
+	if err != nil {
+		log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+		expressionError(w, err)
+		return
+	}
+
+	if _, ok := funcs[def.Name]; ok {
+		log.Printf("%s: %s: %s\n", op, errs.ErrFunctionExists, def.Name)
+		http.Error(w, errs.ErrFunctionExists.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, err := tx.Exec("INSERT INTO functions (login, name, params, body) VALUES ($1, $2, $3, $4)", login, def.Name, strings.Join(def.Params, ","), def.Text); err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("%s: transaction capture error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	log.Printf("%s: function %s for the login %s was added\n", op, def.Name, login)
+}
+
+// userFunctions returns the functions defined by the user. The bodies are parsed after
+// all functions are known, because a body can call the other functions.
+func userFunctions(tx *sql.Tx, login string) (map[string]*expr.Definition, error) {
+	rows, err := tx.Query("SELECT name, params, body FROM functions WHERE login = $1", login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	funcs := make(map[string]*expr.Definition)
+	for rows.Next() {
+		var name, params, body string
+		if err := rows.Scan(&name, &params, &body); err != nil {
+			return nil, err
+		}
+		funcs[name] = &expr.Definition{Name: name, Params: strings.Split(params, ","), Text: body}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, def := range funcs {
+		if def.Body, err = expr.ParseWith(def.Text, expr.Options{Functions: funcs}); err != nil {
+			return nil, err
+		}
+	}
+	return funcs, nil
+}
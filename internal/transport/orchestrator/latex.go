@@ -0,0 +1,162 @@
+package orchestrator
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
+)
+
+// GET /api/v1/render?expression=...
+//
+// The expression or the script is only parsed, the LaTeX formula is returned without scheduling tasks.
+func (o *Orchestrator) Render(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.Render"
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	implicit, ok := implicitQuery(w, r, op)
+	if !ok {
+		return
+	}
+
+	tx, _ := o.db.Begin()
+	defer tx.Rollback()
+
+	funcs, err := userFunctions(tx, login)
+	if err != nil {
+		log.Printf("%s: error while retrieving the functions from the database, error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := expr.Options{ImplicitMultiplication: implicit, Functions: funcs}
+	stmts, err := expr.ParseScript(query.Get("expression"), opts)
+	if err != nil {
+		log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+		expressionError(w, err)
+		return
+	}
+
+	resp := models.RenderResponse{Latex: expr.LaTeXScript(stmts)}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrServer)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: formula of %s for the login %s is %s\n", op, query.Get("expression"), login, resp.Latex)
+}
+
+// renderLatex sets the formula of the expression saved at submission and, when the expression
+// is calculated, the formula of its result: a fraction, a complex number, a quantity or an array.
+func renderLatex(e *models.ExpressionResponse, formula string, exact sql.NullString, result float64, value sql.NullString) error {
+	e.Latex = formula
+	if e.Status != "calculated" {
+		return nil
+	}
+
+	var n expr.Node
+	var err error
+	if value.Valid {
+		n, err = valueNode(value.String)
+	} else {
+		n, err = resultNode(exact, result, e.Imag, e.Unit)
+	}
+	if err != nil {
+		return err
+	}
+	e.LatexResult = expr.LaTeX(n)
+	return nil
+}
+
+// resultNode builds the tree of a result, so that it is rendered like an expression.
+func resultNode(exact sql.NullString, result, imag float64, unit string) (expr.Node, error) {
+	if exact.Valid {
+		r, ok := new(big.Rat).SetString(exact.String)
+		if !ok {
+			return nil, errors.New("invalid exact result: " + exact.String)
+		}
+		return ratNode(r, unit), nil
+	}
+
+	re := &expr.Number{Value: result, Text: strconv.FormatFloat(result, 'g', -1, 64), Unit: unit}
+	if imag == 0 {
+		return re, nil
+	}
+	im := &expr.Number{Value: math.Abs(imag), Imag: true, Text: strconv.FormatFloat(math.Abs(imag), 'g', -1, 64) + expr.Imaginary}
+	switch {
+	case result == 0 && imag < 0:
+		return &expr.Unary{Op: "-", X: im}, nil
+	case result == 0:
+		return im, nil
+	case imag < 0:
+		return &expr.Binary{Op: "-", X: re, Y: im}, nil
+	}
+	return &expr.Binary{Op: "+", X: re, Y: im}, nil
+}
+
+// ratNode builds a fraction, the unit of a quantity is written in the numerator.
+func ratNode(r *big.Rat, unit string) expr.Node {
+	if r.IsInt() {
+		return &expr.Number{Text: r.Num().String(), Unit: unit}
+	}
+	num := &expr.Number{Text: new(big.Int).Abs(r.Num()).String(), Unit: unit}
+	frac := &expr.Binary{Op: "/", X: num, Y: &expr.Number{Text: r.Denom().String()}}
+	if r.Sign() < 0 {
+		return &expr.Unary{Op: "-", X: frac}
+	}
+	return frac
+}
+
+// valueNode builds the array of the value of an expression as it is saved by storeValue.
+func valueNode(value string) (expr.Node, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(value)))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return elementNode(v)
+}
+
+func elementNode(v any) (expr.Node, error) {
+	switch v := v.(type) {
+	case []any:
+		arr := &expr.Array{Elems: make([]expr.Node, len(v))}
+		for i, elem := range v {
+			n, err := elementNode(elem)
+			if err != nil {
+				return nil, err
+			}
+			arr.Elems[i] = n
+		}
+		return arr, nil
+	case json.Number:
+		return &expr.Number{Text: v.String()}, nil
+	case string:
+		return resultNode(sql.NullString{String: v, Valid: true}, 0, 0, "")
+	case map[string]any:
+		re, err1 := strconv.ParseFloat(fmt.Sprint(v["re"]), 64)
+		im, err2 := strconv.ParseFloat(fmt.Sprint(v["im"]), 64)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, err
+		}
+		return resultNode(sql.NullString{}, re, im, "")
+	}
+	return nil, fmt.Errorf("invalid element of value: %v", v)
+}
@@ -7,15 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
-	"unicode"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
 	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
 	task "github.com/kingofhandsomes/calculator-go/proto"
 	"google.golang.org/grpc/codes"
@@ -23,19 +24,25 @@ import (
 )
 
 type Orchestrator struct {
-	secret string
-	db     *sql.DB
+	secret    string
+	db        *sql.DB
+	durations map[string]time.Duration
 	task.TaskServiceServer
 }
 
-func New(secret string, db *sql.DB) *Orchestrator {
+// New creates an orchestrator, durations contains the time of computing for every operation,
+// it is used to estimate the time of planned tasks.
+func New(secret string, db *sql.DB, durations map[string]time.Duration) *Orchestrator {
 	return &Orchestrator{
-		secret: secret,
-		db:     db,
+		secret:    secret,
+		db:        db,
+		durations: durations,
 	}
 }
 
 // /api/v1/calculate
+//
+// With the query parameter dry_run=true the expression is only planned, see dryRun.
 func (o *Orchestrator) Calculate(w http.ResponseWriter, r *http.Request) {
 	const op = "orchestrator.Calculate"
 	var creq models.CalculateRequest
@@ -68,139 +75,308 @@ func (o *Orchestrator) Calculate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expr := strings.ReplaceAll(creq.Expression, " ", "")
-	if !isValidExpression(expr) {
-		log.Printf("%s: %s\n", op, errs.ErrExpression)
-		http.Error(w, errs.ErrExpression.Error(), http.StatusUnprocessableEntity)
+	precision, ok := precisionOf(creq.Precision)
+	if !ok {
+		log.Printf("%s: %s: %s\n", op, errs.ErrPrecision, creq.Precision)
+		http.Error(w, errs.ErrPrecision.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 
-	rpn, err := infixToRPN(expr)
+	dryRun := false
+	if s := r.URL.Query().Get("dry_run"); s != "" {
+		if dryRun, err = strconv.ParseBool(s); err != nil {
+			log.Printf("%s: %s: %s\n", op, errs.ErrDryRun, s)
+			http.Error(w, errs.ErrDryRun.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	funcs, err := userFunctions(tx, login)
 	if err != nil {
-		log.Printf("%s: error when converting an expression to reverse polish notation\n", op)
-		http.Error(w, errs.ErrExpression.Error(), http.StatusUnprocessableEntity)
+		log.Printf("%s: error while retrieving the functions from the database, error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tree, err := expr.ParseWith(creq.Expression, expr.Options{ImplicitMultiplication: creq.ImplicitMultiplication, Functions: funcs})
+	if err != nil {
+		log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+		expressionError(w, err)
+		return
+	}
+	expression := strings.TrimSpace(creq.Expression)
+
+	if dryRun {
+		o.dryRun(w, tx, op, login, expression, precision, tree, funcs, creq.Simplify)
 		return
 	}
 
+	id_expression, ok := submit(w, tx, op, login, expression, precision, []expr.Statement{{X: tree}}, funcs, creq.Simplify)
+	if !ok {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("%s: transaction capture error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(models.CalculateResponse{Id: id_expression}); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrServer)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: expression %s for the login %s was added\n", op, expression, login)
+}
+
+// composition is the plan of an expression with everything that is saved along with its tasks.
+type composition struct {
+	stmts     []expr.Statement
+	precision string
+	tasks     []plannedTask
+	roots     []operand
+	elems     []operand
+	saved     int
+	units     []any
+	shapes    [][]int
+	bound     any
+}
+
+// compose checks the statements of an expression and plans its tasks without writing to the database.
+// Calls of the user-defined functions funcs are inlined before planning, with simplify
+// the statements are simplified and the number of saved tasks is counted.
+// Otherwise it writes the error to the response.
+func compose(w http.ResponseWriter, tx *sql.Tx, op, login, precision string, stmts []expr.Statement, funcs map[string]*expr.Definition, simplify bool) (*composition, bool) {
+	vars, err := userVariables(tx, login)
+	if err != nil {
+		log.Printf("%s: error while retrieving the variables from the database, error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	for i := range stmts {
+		if stmts[i].X, err = expr.Inline(stmts[i].X, funcs); err != nil {
+			log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+			expressionError(w, err)
+			return nil, false
+		}
+	}
+
+	// variables are bound at submission, so later changes of them do not affect the expression
+	stmts, used, err := expr.ResolveScript(stmts, vars)
+	if err != nil {
+		log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+		expressionError(w, err)
+		return nil, false
+	}
+
+	// quantities are checked at submission, the tasks compute them in the base units
+	dims := make(map[string]expr.Dimension)
+	units := make([]any, len(stmts))
+	for i, stmt := range stmts {
+		d, err := expr.Dimensions(stmt.X, dims)
+		if err != nil {
+			log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+			expressionError(w, err)
+			return nil, false
+		}
+		if stmt.Name != "" {
+			dims[stmt.Name] = d
+		}
+		if unit := expr.ResultUnit(stmt.X, d); unit != "" {
+			units[i] = unit
+		}
+	}
+
+	// vectors and matrices are split into the tasks of their elements, the shapes are checked first
+	names := make(map[string][]int)
+	shapes := make([][]int, len(stmts))
+	arrays := false
+	for i, stmt := range stmts {
+		if shapes[i], err = expr.Shape(stmt.X, names); err != nil {
+			log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+			expressionError(w, err)
+			return nil, false
+		}
+		if stmt.Name != "" && shapes[i] != nil {
+			names[stmt.Name] = shapes[i]
+		}
+		arrays = arrays || expr.HasArray(stmt.X)
+	}
+
+	var bound any
+	if len(used) > 0 {
+		data, _ := json.Marshal(used)
+		bound = string(data)
+	}
+
+	// an expression with imaginary numbers is computed with complex numbers
+	for _, stmt := range stmts {
+		if precision == "float" && expr.IsComplex(stmt.X) {
+			precision = "complex"
+		}
+	}
+
+	// the optional pass folds identities and shares common subexpressions, the plan without it
+	// is built first anyway, so that simplification never hides an error of the expression.
+	// Identities like x*0 would turn an array into a number, so arrays are never simplified
+	tasks, roots, elems, err := plan(stmts, precision, false)
+	saved := 0
+	if err == nil && simplify && !arrays {
+		for i := range stmts {
+			stmts[i].X = expr.Simplify(stmts[i].X, precision == "float")
+		}
+		var optimized []plannedTask
+		optimized, roots, elems, err = plan(stmts, precision, true)
+		saved, tasks = len(tasks)-len(optimized), optimized
+	}
+	if err != nil {
+		log.Printf("%s: task composition error: %s\n", op, err)
+		var exprErr *expr.Error
+		if errors.As(err, &exprErr) {
+			expressionError(w, err)
+			return nil, false
+		}
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return &composition{stmts: stmts, precision: precision, tasks: tasks, roots: roots, elems: elems, saved: saved, units: units, shapes: shapes, bound: bound}, true
+}
+
+// submit plans the statements of an expression and saves the tasks, the bindings and
+// the expression to the database, it returns the id of the expression.
+// Otherwise it writes the error to the response.
+func submit(w http.ResponseWriter, tx *sql.Tx, op, login, expression, precision string, stmts []expr.Statement, funcs map[string]*expr.Definition, simplify bool) (int, bool) {
+	// the canonical form and the formula are of the source as it was written, before calls and variables are replaced
+	canonical := expr.FormatScript(stmts)
+	latex := expr.LaTeXScript(stmts)
+
+	c, ok := compose(w, tx, op, login, precision, stmts, funcs, simplify)
+	if !ok {
+		return 0, false
+	}
+
 	row := tx.QueryRow("SELECT count_expressions FROM users WHERE login = $1", login)
 
 	var id_expression int
 
-	err = row.Scan(&id_expression)
+	err := row.Scan(&id_expression)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("%s: '%s' login is not in the users table\n", op, login)
 			http.Error(w, errs.ErrHeaderAuthorization.Error(), http.StatusUnprocessableEntity)
-			return
+			return 0, false
 		}
 		log.Printf("%s: error while retrieving the user from the database, error: %s\n", op, err)
 		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
-		return
+		return 0, false
 	}
 	id_expression++
-	isFirstTask := true
-	id_task := 1
-	var stack []float64
-	for _, oper := range rpn {
-		if n, err := strconv.ParseFloat(oper, 64); err != nil {
-			if len(stack) < 2 {
-				log.Printf("%s: task composition error\n", op)
-				http.Error(w, errs.ErrExpression.Error(), http.StatusUnprocessableEntity)
-				return
-			}
-			arg1, arg2 := stack[len(stack)-2], stack[len(stack)-1]
-			var stts string
-			stts = "not ready"
-			if isFirstTask {
-				stts = "ready"
-				isFirstTask = false
-			}
-			_, err := tx.Exec("INSERT INTO tasks (login, id_expression, id_task, arg1, arg2, operation, stat) VALUES ($1, $2, $3, $4, $5, $6, $7)", login, id_expression, id_task, arg1, arg2, oper, stts)
-			if err != nil {
-				log.Printf("%s: %s\n", op, err)
-				http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
-				return
-			}
-			id_task++
-			stack = stack[:len(stack)-2]
-			var res float64
-			switch oper {
-			case "+":
-				res = arg1 + arg2
-			case "-":
-				res = arg1 - arg2
-			case "*":
-				res = arg1 * arg2
-			case "/":
-				if arg2 == 0 {
-					log.Printf("%s: error dividing by zero\n", op)
-					http.Error(w, errs.ErrExpression.Error(), http.StatusUnprocessableEntity)
-					return
-				}
-				res = arg1 / arg2
-			default:
-				log.Printf("%s: invalid symbol: %s, in expression\n", op, oper)
-				http.Error(w, errs.ErrExpression.Error(), http.StatusUnprocessableEntity)
-				return
-			}
-			stack = append(stack, res)
+
+	for _, t := range c.tasks {
+		stts := "not ready"
+		if t.ready() {
+			stts = "ready"
+		}
+		cond, branch := t.condition()
+		_, err := tx.Exec("INSERT INTO tasks (login, id_expression, id_task, arg1, arg2, imag1, imag2, exact_arg1, exact_arg2, dep1, dep2, cond, branch, operation, precision, stat) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)", login, id_expression, t.id, t.arg1.argument(), t.arg2.argument(), t.arg1.imagArgument(), t.arg2.imagArgument(), t.arg1.exactArgument(), t.arg2.exactArgument(), t.arg1.dependency(), t.arg2.dependency(), cond, branch, t.operation, c.precision, stts)
+		if err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return 0, false
+		}
+	}
+
+	// only numbers are bound, a vector or a matrix is a value of the expression only
+	for i, stmt := range c.stmts {
+		if stmt.Name == "" || c.shapes[i] != nil {
 			continue
-		} else {
-			stack = append(stack, n)
+		}
+		b := c.roots[i]
+		_, err := tx.Exec("INSERT INTO bindings (login, id_expression, position, name, id_task, result, imag_result, exact_result, unit) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", login, id_expression, i, stmt.Name, b.dependency(), b.argument(), b.imagArgument(), b.exactArgument(), c.units[i])
+		if err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return 0, false
 		}
 	}
-	if len(stack) != 1 {
-		log.Printf("%s: task composition error\n", op)
-		http.Error(w, errs.ErrExpression.Error(), http.StatusUnprocessableEntity)
-		return
+
+	// the result of the last statement is the result of the expression, if it is a number
+	// it is saved at once, otherwise it is taken from the root task when all tasks are done
+	root := c.roots[len(c.roots)-1]
+	stat := "not calculated"
+	if len(c.tasks) == 0 {
+		stat = "calculated"
+	}
+
+	// the result of a root task is NULL until the task is calculated and stays NULL after an error,
+	// a vector or a matrix has no root, its value is built from the elements and it has no result
+	var shape any
+	var result, imag, exact any = root.argument(), root.imagArgument(), root.exactArgument()
+	if s := c.shapes[len(c.shapes)-1]; s != nil {
+		data, _ := json.Marshal(s)
+		shape = string(data)
+		result, imag, exact = nil, nil, nil
 	}
 
-	res, err := tx.Exec("INSERT INTO expressions (login, id_expression, expression, stat, result) VALUES ($1, $2, $3, $4, $5)", login, id_expression, expr, "not calculated", 0)
+	res, err := tx.Exec("INSERT INTO expressions (login, id_expression, expression, stat, result, imag_result, precision, exact_result, variables, root, saved_tasks, unit, shape, canonical, latex) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)", login, id_expression, expression, stat, result, imag, c.precision, exact, c.bound, root.dependency(), c.saved, c.units[len(c.units)-1], shape, canonical, latex)
 	if err != nil {
 		log.Printf("%s: error inserting a expression into the expressions table, error: %s\n", op, err)
 		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
-		return
+		return 0, false
 	}
 
 	if rowsAffected, err := res.RowsAffected(); err != nil || rowsAffected == 0 {
 		log.Printf("%s: error returning lines from the request, error: %s\n", op, err)
 		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
-		return
+		return 0, false
+	}
+
+	for i, e := range c.elems {
+		_, err := tx.Exec("INSERT INTO elements (login, id_expression, position, id_task, result, imag_result, exact_result) VALUES ($1, $2, $3, $4, $5, $6, $7)", login, id_expression, i, e.dependency(), e.argument(), e.imagArgument(), e.exactArgument())
+		if err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return 0, false
+		}
+	}
+	if len(c.tasks) == 0 {
+		if err := storeValue(tx, login, int64(id_expression)); err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return 0, false
+		}
 	}
 
 	res, err = tx.Exec("UPDATE users SET count_expressions = $1 WHERE login = $2", id_expression, login)
 	if err != nil {
 		log.Printf("%s: error updating the number of expressions for a user with a login: %s, error: %s\n", op, login, err)
 		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
-		return
+		return 0, false
 	}
 
 	if rowsAffected, err := res.RowsAffected(); err != nil || rowsAffected == 0 {
 		log.Printf("%s: error returning lines from the request, error: %s\n", op, err)
 		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if err = tx.Commit(); err != nil {
-		log.Printf("%s: transaction capture error: %s\n", op, err)
-		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(models.CalculateResponse{Id: id_expression}); err != nil {
-		log.Printf("%s: %s\n", op, errs.ErrServer)
-		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
-		return
+		return 0, false
 	}
 
-	log.Printf("%s: expression %s for the login %s was added\n", op, expr, login)
+	return id_expression, true
 }
 
 // /api/v1/expressions
 func (o *Orchestrator) Expressions(w http.ResponseWriter, r *http.Request) {
 	const op = "orchestrator.Expressions"
 
+	format, base, tex, ok := resultQuery(w, r, op)
+	if !ok {
+		return
+	}
+
 	login, err := checkJWT(r.Header.Get("Authorization"), o.secret)
 	if err != nil {
 		log.Printf("%s: %s\n", op, err)
@@ -223,7 +399,7 @@ func (o *Orchestrator) Expressions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := tx.Query("SELECT id_expression, stat, result FROM expressions WHERE login = $1", login)
+	rows, err := tx.Query("SELECT id_expression, stat, result, COALESCE(imag_result, 0), precision, exact_result, variables, saved_tasks, COALESCE(unit, ''), value, COALESCE(canonical, ''), COALESCE(latex, '') FROM expressions WHERE login = $1", login)
 	if err != nil {
 		log.Printf("%s: %s\n", op, err)
 		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
@@ -234,8 +410,26 @@ func (o *Orchestrator) Expressions(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var expr models.ExpressionResponse
+		var exact, bound, value sql.NullString
+		var result sql.NullFloat64
+		var formula string
 
-		err := rows.Scan(&expr.Id, &expr.Status, &expr.Result)
+		err := rows.Scan(&expr.Id, &expr.Status, &result, &expr.Imag, &expr.Precision, &exact, &bound, &expr.TasksSaved, &expr.Unit, &value, &expr.Canonical, &formula)
+		if result.Valid {
+			expr.Result = &result.Float64
+		}
+		if err == nil && bound.Valid {
+			err = json.Unmarshal([]byte(bound.String), &expr.Variables)
+		}
+		if err == nil && value.Valid {
+			expr.Value = json.RawMessage(value.String)
+		} else if err == nil {
+			expr.BaseResult = baseResult(exact, result.Float64, expr.Imag, base)
+			expr.ExactResult, err = formatResult(exact, result.Float64, expr.Imag, format)
+		}
+		if err == nil && tex {
+			err = renderLatex(&expr, formula, exact, result.Float64, value)
+		}
 		if err != nil {
 			log.Printf("%s: %s\n", op, err)
 			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
@@ -262,6 +456,11 @@ func (o *Orchestrator) Expressions(w http.ResponseWriter, r *http.Request) {
 func (o *Orchestrator) Expression(w http.ResponseWriter, r *http.Request) {
 	const op = "orchestrator.Expression"
 
+	format, base, tex, ok := resultQuery(w, r, op)
+	if !ok {
+		return
+	}
+
 	login, err := checkJWT(r.Header.Get("Authorization"), o.secret)
 	if err != nil {
 		log.Printf("%s: %s\n", op, err)
@@ -293,11 +492,14 @@ func (o *Orchestrator) Expression(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	row := tx.QueryRow("SELECT id_expression, stat, result FROM expressions WHERE login = $1 AND id_expression = $2", login, id)
+	row := tx.QueryRow("SELECT id_expression, stat, result, COALESCE(imag_result, 0), precision, exact_result, variables, saved_tasks, COALESCE(unit, ''), value, COALESCE(canonical, ''), COALESCE(latex, '') FROM expressions WHERE login = $1 AND id_expression = $2", login, id)
 
 	var expr models.ExpressionResponse
+	var exact, bound, value sql.NullString
+	var result sql.NullFloat64
+	var formula string
 
-	err = row.Scan(&expr.Id, &expr.Status, &expr.Result)
+	err = row.Scan(&expr.Id, &expr.Status, &result, &expr.Imag, &expr.Precision, &exact, &bound, &expr.TasksSaved, &expr.Unit, &value, &expr.Canonical, &formula)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("%s: %s\n", op, errs.ErrExpressionId)
@@ -308,6 +510,44 @@ func (o *Orchestrator) Expression(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
 		return
 	}
+	// an exact result that doesn't fit into a float is saved without it
+	if result.Valid {
+		expr.Result = &result.Float64
+	}
+
+	if bound.Valid {
+		if err := json.Unmarshal([]byte(bound.String), &expr.Variables); err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// a vector or a matrix is returned as it is, the format and the base apply to numbers
+	if value.Valid {
+		expr.Value = json.RawMessage(value.String)
+	} else {
+		expr.BaseResult = baseResult(exact, result.Float64, expr.Imag, base)
+		if expr.ExactResult, err = formatResult(exact, result.Float64, expr.Imag, format); err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if tex {
+		if err := renderLatex(&expr, formula, exact, result.Float64, value); err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if expr.Bindings, err = expressionBindings(tx, login, id, format); err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	if err = tx.Commit(); err != nil {
 		log.Printf("%s: transaction capture error: %s\n", op, err)
@@ -326,7 +566,7 @@ func (o *Orchestrator) Expression(w http.ResponseWriter, r *http.Request) {
 
 func (o *Orchestrator) GetTask(context.Context, *task.GetTaskRequest) (*task.GetTaskResponse, error) {
 	var resp task.GetTaskResponse
-	err := o.db.QueryRow("SELECT login, id_expression, id_task, arg1, arg2, operation FROM tasks WHERE stat = 'ready'").Scan(&resp.Login, &resp.IdExpression, &resp.IdTask, &resp.Arg1, &resp.Arg2, &resp.Operation)
+	err := o.db.QueryRow("SELECT login, id_expression, id_task, COALESCE(arg1, 0), COALESCE(arg2, 0), COALESCE(imag1, 0), COALESCE(imag2, 0), operation, precision, COALESCE(exact_arg1, ''), COALESCE(exact_arg2, '') FROM tasks WHERE stat = 'ready'").Scan(&resp.Login, &resp.IdExpression, &resp.IdTask, &resp.Arg1, &resp.Arg2, &resp.Imag1, &resp.Imag2, &resp.Operation, &resp.Precision, &resp.ExactArg1, &resp.ExactArg2)
 	if err != nil {
 		return nil, status.Error(codes.NotFound, "task not found")
 	}
@@ -340,16 +580,75 @@ func (o *Orchestrator) PostTask(ctx context.Context, req *task.PostTaskRequest)
 	tx, _ := o.db.Begin()
 	defer tx.Rollback()
 
-	_, err := tx.Exec("UPDATE tasks SET stat = 'calculated', operation_time = $1, result = $2 WHERE login = $3 AND id_expression = $4 AND id_task = $5", req.OperationTime, req.Result, req.Login, req.IdExpression, req.IdTask)
+	if req.GetError() != "" {
+		log.Printf("%s: task was failed, login: %s, id of expression: %d, id of task: %d, error: %s\n", op, req.GetLogin(), req.GetIdExpression(), req.GetIdTask(), req.GetError())
+		tx.Exec("UPDATE tasks SET stat = 'error', operation_time = $1 WHERE login = $2 AND id_expression = $3 AND id_task = $4", req.OperationTime, req.Login, req.IdExpression, req.IdTask)
+		tx.Exec("UPDATE tasks SET stat = 'cancelled' WHERE login = $1 AND id_expression = $2 AND stat IN ('not ready', 'ready')", req.Login, req.IdExpression)
+		tx.Exec("UPDATE expressions SET stat = 'error' WHERE login = $1 AND id_expression = $2", req.Login, req.IdExpression)
+		if err := tx.Commit(); err != nil {
+			log.Printf("%s: transaction capture error: %s\n", op, err)
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &task.PostTaskResponse{}, nil
+	}
+
+	var exactResult any
+	if req.GetExactResult() != "" {
+		exactResult = req.GetExactResult()
+	}
+	// an exact result that doesn't fit into a float is saved as a fraction only, the tasks that
+	// depend on it read exact_arg, the agent never posts other results that aren't finite
+	var result any = req.GetResult()
+	if exactResult != nil && (math.IsInf(req.GetResult(), 0) || math.IsNaN(req.GetResult())) {
+		result = nil
+	}
+
+	_, err := tx.Exec("UPDATE tasks SET stat = 'calculated', operation_time = $1, result = $2, imag_result = $3, exact_result = $4 WHERE login = $5 AND id_expression = $6 AND id_task = $7", req.OperationTime, result, req.ImagResult, exactResult, req.Login, req.IdExpression, req.IdTask)
 	if err != nil {
 		log.Printf("%s: %s\n", op, err)
 		return nil, status.Error(codes.Internal, "server error")
 	}
 
-	res, _ := tx.Exec("UPDATE tasks SET stat = 'ready' WHERE login = $1 AND id_expression = $2 AND id_task = $3", req.Login, req.IdExpression, req.IdTask+1)
-	if n, _ := res.RowsAffected(); n == 0 {
+	// the result is passed on to the tasks that refer to it
+	for _, arg := range []string{"1", "2"} {
+		_, err = tx.Exec("UPDATE tasks SET arg"+arg+" = $1, imag"+arg+" = $2, exact_arg"+arg+" = $3 WHERE login = $4 AND id_expression = $5 AND dep"+arg+" = $6", result, req.ImagResult, exactResult, req.Login, req.IdExpression, req.IdTask)
+		if err != nil {
+			log.Printf("%s: %s\n", op, err)
+			return nil, status.Error(codes.Internal, "server error")
+		}
+	}
+
+	// if the task is a condition of if, one of the branches is chosen
+	chosen := 2
+	if req.GetResult() != 0 || req.GetImagResult() != 0 || (req.GetExactResult() != "" && req.GetExactResult() != "0") {
+		chosen = 1
+	}
+	if err := chooseBranch(tx, req.GetLogin(), req.GetIdExpression(), req.GetIdTask(), chosen); err != nil {
+		log.Printf("%s: %s\n", op, err)
+		return nil, status.Error(codes.Internal, "server error")
+	}
+
+	// every task whose dependencies have all been calculated becomes ready
+	_, err = tx.Exec(`UPDATE tasks SET stat = 'ready' WHERE login = $1 AND id_expression = $2 AND stat = 'not ready' AND cond IS NULL AND NOT EXISTS (
+		SELECT 1 FROM tasks AS dep WHERE dep.login = tasks.login AND dep.id_expression = tasks.id_expression AND dep.id_task IN (tasks.dep1, tasks.dep2) AND dep.stat != 'calculated')`, req.Login, req.IdExpression)
+	if err != nil {
+		log.Printf("%s: %s\n", op, err)
+		return nil, status.Error(codes.Internal, "server error")
+	}
+
+	var left int
+	tx.QueryRow("SELECT COUNT(*) FROM tasks WHERE login = $1 AND id_expression = $2 AND stat NOT IN ('calculated', 'skipped')", req.Login, req.IdExpression).Scan(&left)
+	if left == 0 {
 		log.Printf("%s: expression was calculated, login: %s, id of expression: %d\n", op, req.GetLogin(), req.GetIdExpression())
-		tx.Exec("UPDATE expressions SET stat = 'calculated', result = $1 WHERE login = $2 AND id_expression = $3", req.Result, req.Login, req.IdExpression)
+		// the result of a script whose last statement is a number was saved at submission
+		tx.Exec("UPDATE expressions SET stat = 'calculated' WHERE login = $1 AND id_expression = $2", req.Login, req.IdExpression)
+		tx.Exec(`UPDATE expressions SET (result, imag_result, exact_result) = (
+			SELECT result, COALESCE(imag_result, 0), exact_result FROM tasks WHERE tasks.login = expressions.login AND tasks.id_expression = expressions.id_expression AND tasks.id_task = expressions.root)
+			WHERE login = $1 AND id_expression = $2 AND root IS NOT NULL`, req.Login, req.IdExpression)
+		if err := storeValue(tx, req.GetLogin(), req.GetIdExpression()); err != nil {
+			log.Printf("%s: %s\n", op, err)
+			return nil, status.Error(codes.Internal, "server error")
+		}
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -360,110 +659,60 @@ func (o *Orchestrator) PostTask(ctx context.Context, req *task.PostTaskRequest)
 	return &task.PostTaskResponse{}, nil
 }
 
-var precedence = map[rune]int{
-	'+': 1,
-	'-': 1,
-	'*': 2,
-	'/': 2,
-}
+// chooseBranch schedules the chosen branch of every if whose condition is the task and skips
+// the other branch together with all tasks that depend on the skipped ones.
+func chooseBranch(tx *sql.Tx, login string, id_expression, id_task int64, chosen int) error {
+	// the task of if passes on the result of the chosen branch as its first argument
+	if chosen == 2 {
+		if _, err := tx.Exec("UPDATE tasks SET arg1 = arg2, imag1 = imag2, exact_arg1 = exact_arg2, dep1 = dep2 WHERE login = $1 AND id_expression = $2 AND cond = $3 AND branch IS NULL", login, id_expression, id_task); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE tasks SET arg2 = 0, imag2 = 0, exact_arg2 = NULL, dep2 = NULL WHERE login = $1 AND id_expression = $2 AND cond = $3 AND branch IS NULL", login, id_expression, id_task); err != nil {
+		return err
+	}
 
-func isOperator(r rune) bool {
-	return r == '+' || r == '-' || r == '*' || r == '/'
+	if _, err := tx.Exec("UPDATE tasks SET stat = 'skipped' WHERE login = $1 AND id_expression = $2 AND cond = $3 AND branch != $4", login, id_expression, id_task, chosen); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE tasks SET cond = NULL, branch = NULL WHERE login = $1 AND id_expression = $2 AND cond = $3 AND stat != 'skipped'", login, id_expression, id_task); err != nil {
+		return err
+	}
+
+	// nested conditions and operations of the skipped branch are skipped too
+	for {
+		res, err := tx.Exec(`UPDATE tasks SET stat = 'skipped' WHERE login = $1 AND id_expression = $2 AND stat = 'not ready' AND EXISTS (
+			SELECT 1 FROM tasks AS dep WHERE dep.login = tasks.login AND dep.id_expression = tasks.id_expression AND dep.id_task IN (tasks.dep1, tasks.dep2, tasks.cond) AND dep.stat = 'skipped')`, login, id_expression)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+	}
 }
 
-func tokenize(expr string) ([]string, error) {
-	var tokens []string
-	var number strings.Builder
-
-	expr = strings.ReplaceAll(expr, " ", "")
-
-	for i, ch := range expr {
-		if unicode.IsDigit(ch) {
-			number.WriteRune(ch)
-		} else if ch == '-' {
-			if i == 0 || (i > 0 && (expr[i-1] == '(' || isOperator(rune(expr[i-1])))) {
-				number.WriteRune(ch)
-				continue
-			} else {
-				if number.Len() > 0 {
-					tokens = append(tokens, number.String())
-					number.Reset()
-				}
-				tokens = append(tokens, "-")
-			}
-		} else if isOperator(rune(ch)) || ch == '(' || ch == ')' {
-			if number.Len() > 0 {
-				tokens = append(tokens, number.String())
-				number.Reset()
-			}
-			tokens = append(tokens, string(ch))
-		} else {
-			return nil, errors.New("invalid symbol: " + string(ch))
-		}
-	}
-	if number.Len() > 0 {
-		tokens = append(tokens, number.String())
-	}
-
-	return tokens, nil
+// precisionOf returns the precision of computing, float by default.
+func precisionOf(precision string) (string, bool) {
+	switch precision {
+	case "":
+		return "float", true
+	case "float", "exact", "complex":
+		return precision, true
+	}
+	return "", false
 }
 
-func infixToRPN(expr string) ([]string, error) {
-	tokens, err := tokenize(expr)
-	if err != nil {
-		return nil, err
-	}
-
-	var output []string
-	var stack []rune
-
-	for _, token := range tokens {
-		if _, err := strconv.Atoi(token); err == nil {
-			output = append(output, token)
-		} else if len(token) == 1 && isOperator(rune(token[0])) {
-			currOp := rune(token[0])
-			for len(stack) > 0 {
-				top := stack[len(stack)-1]
-				if isOperator(top) && precedence[top] >= precedence[currOp] {
-					output = append(output, string(top))
-					stack = stack[:len(stack)-1]
-				} else {
-					break
-				}
-			}
-			stack = append(stack, currOp)
-		} else if token == "(" {
-			stack = append(stack, '(')
-		} else if token == ")" {
-			found := false
-			for len(stack) > 0 {
-				top := stack[len(stack)-1]
-				if top == '(' {
-					stack = stack[:len(stack)-1]
-					found = true
-					break
-				}
-				output = append(output, string(top))
-				stack = stack[:len(stack)-1]
-			}
-			if !found {
-				return nil, errors.New("bracket mismatch")
-			}
-		} else {
-			return nil, errors.New("invalid symbol: " + token)
-		}
-	}
-
-	for len(stack) > 0 {
-		top := stack[len(stack)-1]
-		if top == '(' || top == ')' {
-			return nil, errors.New("bracket mismatch")
-		}
-		output = append(output, string(top))
-		stack = stack[:len(stack)-1]
-	}
-
-	return output, nil
+// expressionError reports where and why the expression is incorrect.
+func expressionError(w http.ResponseWriter, err error) {
+	var exprErr *expr.Error
+	if !errors.As(err, &exprErr) {
+		http.Error(w, errs.ErrExpression.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Code: exprErr.Code, Position: exprErr.Pos, Message: exprErr.Msg})
 }
 
 func checkJWT(jwt_token, secret string) (string, error) {
@@ -497,30 +746,3 @@ func checkJWT(jwt_token, secret string) (string, error) {
 	return fmt.Sprint(claims["login"]), nil
 
 }
-
-func isValidExpression(expr string) bool {
-	validPattern := `^[-+*/()\d]+$`
-	matched, _ := regexp.MatchString(validPattern, expr)
-	if !matched {
-		return false
-	}
-	stack := []rune{}
-	for _, ch := range expr {
-		if ch == '(' {
-			stack = append(stack, ch)
-		} else if ch == ')' {
-			if len(stack) == 0 {
-				return false
-			}
-			stack = stack[:len(stack)-1]
-		}
-	}
-	if len(stack) != 0 {
-		return false
-	}
-
-	syntaxPattern := `([\+\-\*/]{2,})|([\+\-\*/][\)])|([$$][$$])|([$$]$)|(^[\+\*/])`
-	syntaxRegex := regexp.MustCompile(syntaxPattern)
-
-	return !syntaxRegex.MatchString(expr)
-}
@@ -0,0 +1,400 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+)
+
+// operand is an argument of a task: either a number or a reference to the result of the task with the given id.
+// In the exact mode the number is also kept as an exact fraction in the exact field,
+// in the complex mode value is the real part and imag is the imaginary part of the number.
+type operand struct {
+	value float64
+	imag  float64
+	exact string
+	task  int
+}
+
+func (o operand) argument() any {
+	if o.task != 0 {
+		return nil
+	}
+	return o.value
+}
+
+func (o operand) imagArgument() any {
+	if o.task != 0 {
+		return nil
+	}
+	return o.imag
+}
+
+func (o operand) exactArgument() any {
+	if o.task != 0 || o.exact == "" {
+		return nil
+	}
+	return o.exact
+}
+
+// negate returns the number with the opposite sign.
+func (o operand) negate() operand {
+	o.value, o.imag = -o.value, -o.imag
+	if r, ok := new(big.Rat).SetString(o.exact); ok {
+		o.exact = r.Neg(r).RatString()
+	}
+	return o
+}
+
+func (o operand) dependency() any {
+	if o.task == 0 {
+		return nil
+	}
+	return o.task
+}
+
+// plannedTask is a task of an expression before it is saved to the tasks table.
+// A task of a branch of if has the id of the condition task in cond and the number
+// of the branch (1 or 2) in branch, it is scheduled only if the branch is chosen.
+// The task of if itself has cond without branch, it passes on the result of the chosen branch.
+type plannedTask struct {
+	id           int
+	arg1, arg2   operand
+	operation    string
+	cond, branch int
+}
+
+func (t plannedTask) ready() bool {
+	return t.arg1.task == 0 && t.arg2.task == 0 && t.cond == 0
+}
+
+func (t plannedTask) condition() (any, any) {
+	if t.cond == 0 {
+		return nil, nil
+	}
+	if t.branch == 0 {
+		return t.cond, nil
+	}
+	return t.cond, t.branch
+}
+
+// plan converts the statements of a script into tasks, ids of tasks start from 1.
+// An expression is a script of one statement. The returned operands are the results
+// of the statements, a statement whose value is a vector or a matrix has a zero operand
+// and, if it is the last one, its elements in row-major order are returned separately.
+// In the exact mode operations that can't be computed exactly are rejected.
+// With cse identical subexpressions are computed by one task.
+func plan(stmts []expr.Statement, precision string, cse bool) ([]plannedTask, []operand, []operand, error) {
+	p := &planner{exact: precision == "exact", names: make(map[string]operand), arrays: make(map[string][]operand), shapes: make(map[string][]int)}
+	if cse {
+		p.planned = make(map[string]operand)
+	}
+	roots := make([]operand, len(stmts))
+	var elems []operand
+	for i, stmt := range stmts {
+		shape, err := expr.Shape(stmt.X, p.shapes)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		elems = nil
+		if shape != nil {
+			if elems, err = p.elements(stmt.X); err != nil {
+				return nil, nil, nil, err
+			}
+			if stmt.Name != "" {
+				p.arrays[stmt.Name], p.shapes[stmt.Name] = elems, shape
+			}
+			continue
+		}
+
+		// a name is bound to the quantity in the base units, the conversion changes only the result
+		x := stmt.X
+		conv, ok := x.(*expr.Binary)
+		if ok && conv.Op == expr.Conversion {
+			x = conv.X
+		}
+		value, err := p.node(x)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		root := value
+		if x != stmt.X {
+			if root, err = p.convert(value, conv.Y.(*expr.Number).Unit); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if stmt.Name != "" {
+			p.names[stmt.Name] = value
+		}
+		roots[i] = root
+	}
+	return p.tasks, roots, elems, nil
+}
+
+type planner struct {
+	exact bool
+	tasks []plannedTask
+	// names are the results of the statements bound to names
+	names map[string]operand
+	// arrays and shapes are the elements and the shapes of the vectors and matrices bound to names
+	arrays map[string][]operand
+	shapes map[string][]int
+	// cond and branch are the condition task and the branch of if whose tasks are being planned
+	cond, branch int
+	// planned are the results of the subexpressions that have been planned, by the branch
+	// and the text of a subexpression, it is nil when common subexpressions are not shared
+	planned map[string]operand
+}
+
+func (p *planner) add(operation string, arg1, arg2 operand) operand {
+	p.tasks = append(p.tasks, plannedTask{id: len(p.tasks) + 1, arg1: arg1, arg2: arg2, operation: operation, cond: p.cond, branch: p.branch})
+	return operand{task: len(p.tasks)}
+}
+
+// node plans the tasks of the operands before the task of the node. A subexpression that
+// has already been planned in the same branch or outside of any if is reused.
+func (p *planner) node(n expr.Node) (operand, error) {
+	if p.planned == nil {
+		return p.expand(n)
+	}
+	text := expr.String(n)
+	key := fmt.Sprintf("%d/%d/%s", p.cond, p.branch, text)
+	if res, ok := p.planned[key]; ok {
+		return res, nil
+	}
+	if res, ok := p.planned["0/0/"+text]; ok {
+		return res, nil
+	}
+	res, err := p.expand(n)
+	if err != nil {
+		return operand{}, err
+	}
+	if res.task != 0 {
+		p.planned[key] = res
+	}
+	return res, nil
+}
+
+func (p *planner) expand(n expr.Node) (operand, error) {
+	switch n := n.(type) {
+	case *expr.Number:
+		num := operand{value: n.Value}
+		if n.Imag {
+			num = operand{imag: n.Value}
+		}
+		if p.exact {
+			r, ok := new(big.Rat).SetString(n.Text)
+			if !ok {
+				return operand{}, &expr.Error{Code: expr.CodeNotExact, Pos: n.Pos(), Msg: fmt.Sprintf("'%s' can't be represented exactly", n.Text)}
+			}
+			num.exact = r.RatString()
+		} else if !floatInteger(n) {
+			return operand{}, &expr.Error{Code: expr.CodeNotExact, Pos: n.Pos(), Msg: fmt.Sprintf("integer '%s' can't be represented exactly in floats, use \"precision\":\"exact\"", n.Text)}
+		}
+		if n.Unit != "" {
+			return quantity(num, n)
+		}
+		return num, nil
+	case *expr.Ident:
+		if root, ok := p.names[n.Name]; ok {
+			return root, nil
+		}
+		return operand{}, &expr.Error{Code: expr.CodeUnknownIdent, Pos: n.Pos(), Msg: fmt.Sprintf("unknown name '%s'", n.Name)}
+	case *expr.Unary:
+		x, err := p.node(n.X)
+		if err != nil {
+			return operand{}, err
+		}
+		return p.unary(n, x)
+	case *expr.Binary:
+		x, err := p.node(n.X)
+		if err != nil {
+			return operand{}, err
+		}
+		if n.Op == expr.Conversion {
+			return p.convert(x, n.Y.(*expr.Number).Unit)
+		}
+		y, err := p.node(n.Y)
+		if err != nil {
+			return operand{}, err
+		}
+		return p.binary(n, x, y)
+	case *expr.Call:
+		switch n.Func {
+		case "if":
+			return p.conditional(n)
+		case "dot":
+			return p.dot(n)
+		case "det":
+			return p.determinant(n)
+		}
+		args := make([]operand, len(n.Args))
+		for i, arg := range n.Args {
+			a, err := p.node(arg)
+			if err != nil {
+				return operand{}, err
+			}
+			args[i] = a
+		}
+		fn, err := p.function(n)
+		if err != nil {
+			return operand{}, err
+		}
+		if fn.MaxArgs == 1 {
+			return p.add(n.Func, args[0], operand{}), nil
+		}
+		return reduce(n.Func, args, p.add), nil
+	}
+	return operand{}, fmt.Errorf("unknown node %T", n)
+}
+
+func (p *planner) unary(n *expr.Unary, x operand) (operand, error) {
+	switch {
+	case n.Op == "+":
+		return x, nil
+	case n.Op == "not":
+		return p.add(n.Op, x, operand{}), nil
+	case n.Op == "!":
+		return p.factorial(n, x)
+	case n.Op == "%":
+		return p.percent(x), nil
+	case x.task == 0:
+		// the parser keeps the sign of a literal as an operator, it is applied here without a task
+		return x.negate(), nil
+	}
+	return p.add("-", p.literal(0), x), nil
+}
+
+// floatInteger reports whether the float of the literal is exact if the literal is an integer,
+// for example 9007199254740993 is rounded to 9007199254740992 and 2^60 is exact.
+// A leading zero of a decimal literal isn't the prefix of octal numbers, so 010 is ten.
+func floatInteger(n *expr.Number) bool {
+	base := 10
+	if len(n.Text) > 1 && n.Text[0] == '0' && strings.ContainsRune("xXbBoO", rune(n.Text[1])) {
+		base = 0
+	}
+	i, ok := new(big.Int).SetString(n.Text, base)
+	if !ok {
+		return true
+	}
+	f, _ := big.NewFloat(n.Value).Int(nil)
+	return f.Cmp(i) == 0
+}
+
+// literal returns the integer as an operand, in the exact mode it is also an exact fraction.
+func (p *planner) literal(v int64) operand {
+	o := operand{value: float64(v)}
+	if p.exact {
+		o.exact = big.NewRat(v, 1).RatString()
+	}
+	return o
+}
+
+func (p *planner) binary(n *expr.Binary, x, y operand) (operand, error) {
+	// a branch that is never chosen may divide by zero, so it is left to the agent
+	if (n.Op == "/" || n.Op == "%" || n.Op == "//") && p.cond == 0 && y.task == 0 && y.value == 0 && y.imag == 0 {
+		return operand{}, &expr.Error{Code: expr.CodeDivisionByZero, Pos: n.Y.Pos(), Msg: "division by zero"}
+	}
+	return p.add(n.Op, x, y), nil
+}
+
+func (p *planner) function(n *expr.Call) (expr.Function, error) {
+	fn := expr.Functions[n.Func]
+	if p.exact && !fn.Exact {
+		return fn, &expr.Error{Code: expr.CodeNotExact, Pos: n.Pos(), Msg: fmt.Sprintf("function '%s' can't be computed exactly", n.Func)}
+	}
+	return fn, nil
+}
+
+// conditional plans if(cond, a, b). The tasks of the branches wait for the condition task,
+// then the tasks of the other branch are skipped. A constant condition chooses the branch at once.
+func (p *planner) conditional(n *expr.Call) (operand, error) {
+	c, err := p.node(n.Args[0])
+	if err != nil {
+		return operand{}, err
+	}
+	if c.task == 0 {
+		if c.value != 0 || c.imag != 0 {
+			return p.node(n.Args[1])
+		}
+		return p.node(n.Args[2])
+	}
+
+	cond, branch := p.cond, p.branch
+	defer func() { p.cond, p.branch = cond, branch }()
+
+	var branches [2]operand
+	for i := range branches {
+		p.cond, p.branch = c.task, i+1
+		if branches[i], err = p.node(n.Args[i+1]); err != nil {
+			return operand{}, err
+		}
+	}
+	p.cond, p.branch = c.task, 0
+	return p.add(n.Func, branches[0], branches[1]), nil
+}
+
+// quantity converts the magnitude of a quantity to the base units, for example 5 km is 5000.
+func quantity(num operand, n *expr.Number) (operand, error) {
+	u, err := expr.ParseUnit(n.Unit)
+	if err != nil {
+		return operand{}, err
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimSuffix(n.Text, expr.Imaginary))
+	if !ok {
+		r = new(big.Rat).SetFloat64(n.Value)
+	}
+	r.Mul(r, u.Factor)
+	v, _ := r.Float64()
+	if n.Imag {
+		num.imag = v
+	} else {
+		num.value = v
+	}
+	if num.exact != "" {
+		num.exact = r.RatString()
+	}
+	return num, nil
+}
+
+// convert divides the quantity in the base units by the factor of the unit.
+func (p *planner) convert(x operand, unit string) (operand, error) {
+	u, err := expr.ParseUnit(unit)
+	if err != nil {
+		return operand{}, err
+	}
+	if u.Factor.Cmp(big.NewRat(1, 1)) == 0 {
+		return x, nil
+	}
+	f, _ := u.Factor.Float64()
+	factor := operand{value: f}
+	if p.exact {
+		factor.exact = u.Factor.RatString()
+	}
+	if x.task != 0 {
+		return p.add("/", x, factor), nil
+	}
+	x.value, x.imag = x.value/f, x.imag/f
+	if r, ok := new(big.Rat).SetString(x.exact); ok {
+		x.exact = r.Quo(r, u.Factor).RatString()
+	}
+	return x, nil
+}
+
+// reduce combines the arguments of a variadic function by pairs, so that the tasks of
+// each level of the resulting tree are independent and can be computed at the same time.
+func reduce(operation string, args []operand, add func(string, operand, operand) operand) operand {
+	for len(args) > 1 {
+		var next []operand
+		for i := 0; i+1 < len(args); i += 2 {
+			next = append(next, add(operation, args[i], args[i+1]))
+		}
+		if len(args)%2 == 1 {
+			next = append(next, args[len(args)-1])
+		}
+		args = next
+	}
+	return args[0]
+}
@@ -0,0 +1,107 @@
+package orchestrator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
+)
+
+// POST /api/v1/scripts
+func (o *Orchestrator) Script(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.Script"
+
+	var sreq models.ScriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&sreq); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrRequestJSON)
+		http.Error(w, errs.ErrRequestJSON.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	precision, ok := precisionOf(sreq.Precision)
+	if !ok {
+		log.Printf("%s: %s: %s\n", op, errs.ErrPrecision, sreq.Precision)
+		http.Error(w, errs.ErrPrecision.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	tx, _ := o.db.Begin()
+	defer tx.Rollback()
+
+	funcs, err := userFunctions(tx, login)
+	if err != nil {
+		log.Printf("%s: error while retrieving the functions from the database, error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stmts, err := expr.ParseScript(sreq.Script, expr.Options{ImplicitMultiplication: sreq.ImplicitMultiplication, Functions: funcs})
+	if err != nil {
+		log.Printf("%s: %s: %s\n", op, errs.ErrExpression, err)
+		expressionError(w, err)
+		return
+	}
+	script := strings.TrimSpace(sreq.Script)
+
+	id_expression, ok := submit(w, tx, op, login, script, precision, stmts, funcs, sreq.Simplify)
+	if !ok {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("%s: transaction capture error: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(models.CalculateResponse{Id: id_expression}); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrServer)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: script %s for the login %s was added\n", op, script, login)
+}
+
+// expressionBindings returns the values bound to names by the statements of a script
+// in the order of the statements. A value is taken from its task until the task is calculated.
+func expressionBindings(tx *sql.Tx, login string, id_expression int, format string) ([]models.Binding, error) {
+	rows, err := tx.Query(`SELECT b.name,
+		CASE WHEN t.id_task IS NULL OR t.stat = 'calculated' THEN 'calculated' WHEN t.stat IN ('error', 'cancelled') THEN 'error' ELSE 'not calculated' END,
+		CASE WHEN t.stat = 'calculated' THEN t.result ELSE COALESCE(t.result, b.result, 0) END, COALESCE(t.imag_result, b.imag_result, 0), COALESCE(t.exact_result, b.exact_result), COALESCE(b.unit, '')
+		FROM bindings AS b LEFT JOIN tasks AS t ON t.login = b.login AND t.id_expression = b.id_expression AND t.id_task = b.id_task
+		WHERE b.login = $1 AND b.id_expression = $2 ORDER BY b.position`, login, id_expression)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bindings []models.Binding
+	for rows.Next() {
+		var b models.Binding
+		var exact sql.NullString
+		var value sql.NullFloat64
+		if err := rows.Scan(&b.Name, &b.Status, &value, &b.Imag, &exact, &b.Unit); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			b.Value = &value.Float64
+		}
+		if b.ExactValue, err = formatResult(exact, value.Float64, b.Imag, format); err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, rows.Err()
+}
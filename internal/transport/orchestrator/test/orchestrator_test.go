@@ -2,21 +2,26 @@ package auth_test
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
 	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
 	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
 	"github.com/kingofhandsomes/calculator-go/internal/transport/auth"
 	"github.com/kingofhandsomes/calculator-go/internal/transport/orchestrator"
+	task "github.com/kingofhandsomes/calculator-go/proto"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -36,153 +41,1306 @@ func TestOrchestrator(t *testing.T) {
 		t.Fatalf("error creating table users, error: %s", err)
 	}
 
-	if _, err := db.Exec("CREATE TABLE expressions (login TEXT NOT NULL, id_expression INTEGER NOT NULL, expression TEXT NOT NULL, stat TEXT NOT NULL, result REAL NULL, FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+	if _, err := db.Exec("CREATE TABLE expressions (login TEXT NOT NULL, id_expression INTEGER NOT NULL, expression TEXT NOT NULL, stat TEXT NOT NULL, result REAL NULL, imag_result REAL NULL, precision TEXT NOT NULL DEFAULT 'float', exact_result TEXT NULL, variables TEXT NULL, root INTEGER NULL, saved_tasks INTEGER NOT NULL DEFAULT 0, unit TEXT NULL, shape TEXT NULL, value TEXT NULL, canonical TEXT NULL, latex TEXT NULL, FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
 		t.Fatalf("error creating table expressions, error: %s", err)
 	}
 
-	if _, err := db.Exec("CREATE TABLE tasks (login TEXT NOT NULL, id_expression INTEGER NOT NULL, id_task INTEGER NOT NULL, arg1 REAL NOT NULL, arg2 REAL NOT NULL, operation STRING NOT NULL, stat STRING NOT NULL, operation_time INTEGER NULL, result REAL NULL)"); err != nil {
+	if _, err := db.Exec("CREATE TABLE variables (login TEXT NOT NULL, name TEXT NOT NULL, value REAL NOT NULL, PRIMARY KEY (login, name), FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+		t.Fatalf("error creating table variables, error: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE functions (login TEXT NOT NULL, name TEXT NOT NULL, params TEXT NOT NULL, body TEXT NOT NULL, PRIMARY KEY (login, name), FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+		t.Fatalf("error creating table functions, error: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE bindings (login TEXT NOT NULL, id_expression INTEGER NOT NULL, position INTEGER NOT NULL, name TEXT NOT NULL, id_task INTEGER NULL, result REAL NULL, imag_result REAL NULL, exact_result TEXT NULL, unit TEXT NULL, FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+		t.Fatalf("error creating table bindings, error: %s", err)
+	}
+
+	if _, err := db.Exec("CREATE TABLE elements (login TEXT NOT NULL, id_expression INTEGER NOT NULL, position INTEGER NOT NULL, id_task INTEGER NULL, result REAL NULL, imag_result REAL NULL, exact_result TEXT NULL, FOREIGN KEY (login) REFERENCES users(login))"); err != nil {
+		t.Fatalf("error creating table elements, error: %s", err)
+	}
+
+	if _, err := db.Exec("CREATE TABLE tasks (login TEXT NOT NULL, id_expression INTEGER NOT NULL, id_task INTEGER NOT NULL, arg1 REAL NULL, arg2 REAL NULL, imag1 REAL NULL, imag2 REAL NULL, exact_arg1 TEXT NULL, exact_arg2 TEXT NULL, dep1 INTEGER NULL, dep2 INTEGER NULL, cond INTEGER NULL, branch INTEGER NULL, operation STRING NOT NULL, precision TEXT NOT NULL DEFAULT 'float', stat STRING NOT NULL, operation_time INTEGER NULL, result REAL NULL, imag_result REAL NULL, exact_result TEXT NULL)"); err != nil {
 		t.Fatalf("error creating table tasks, error: %s", err)
 	}
 
-	if res, err := db.Exec("INSERT INTO users (login, password, count_expressions) VALUES ('roman', 'qwerty', 0)"); err != nil {
-		t.Fatalf("error insert user, error: %s", err)
-	} else {
-		if n, _ := res.RowsAffected(); n == 0 {
-			t.Fatalf("error insert user")
+	if res, err := db.Exec("INSERT INTO users (login, password, count_expressions) VALUES ('roman', 'qwerty', 0)"); err != nil {
+		t.Fatalf("error insert user, error: %s", err)
+	} else {
+		if n, _ := res.RowsAffected(); n == 0 {
+			t.Fatalf("error insert user")
+		}
+	}
+	if res, err := db.Exec("INSERT INTO users (login, password, count_expressions) VALUES ('roman1', 'qwerty1', 0)"); err != nil {
+		t.Fatalf("error insert user, error: %s", err)
+	} else {
+		if n, _ := res.RowsAffected(); n == 0 {
+			t.Fatalf("error insert user")
+		}
+	}
+
+	secret := "aspfdjspgashrgoasrnvpuasrighbousrb"
+
+	durations := map[string]time.Duration{"+": time.Millisecond, "-": time.Millisecond, "*": 2 * time.Millisecond, "/": 3 * time.Millisecond, "sqrt": 4 * time.Millisecond}
+	o := orchestrator.New(secret, db, durations)
+
+	testCalculateCases := []struct {
+		name               string
+		login              string
+		password           string
+		ttl                time.Duration
+		expression         string
+		precision          string
+		implicit           bool
+		expectedStatusCode int
+		expectedError      bool
+		expectedId         int
+		expectedMessage    string
+		expectedCode       string
+		expectedPosition   int
+	}{
+		{
+			name:               "calculate: correctly1",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1+2-3*4/5",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         1,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: correctly2",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1+(2-3)*4/5+(-2)",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         2,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: correctly3",
+			login:              "roman1",
+			password:           "qwerty1",
+			ttl:                time.Duration(time.Hour),
+			expression:         "14+22-31*47/53",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         1,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: correctly4",
+			login:              "roman1",
+			password:           "qwerty1",
+			ttl:                time.Duration(time.Hour),
+			expression:         "16+(21-33)*45/45+(-21)",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         2,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: correctly5",
+			login:              "roman1",
+			password:           "qwerty1",
+			ttl:                time.Duration(time.Hour),
+			expression:         "(1+2)*(3+4)",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         3,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: decimal fractions",
+			login:              "roman1",
+			password:           "qwerty1",
+			ttl:                time.Duration(time.Hour),
+			expression:         "2.5*4-0.75",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         4,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: exponent notation",
+			login:              "roman1",
+			password:           "qwerty1",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1e3/7+2.5E-2",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         5,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: exact precision",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "123456789*987654321",
+			precision:          "exact",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         3,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: exact literal",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "-3.5",
+			precision:          "exact",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         4,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: complex numbers",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "(1+2i)*(3-i)",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         5,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: unary minus",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "-(1+2)",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         6,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: implicit multiplication",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "2(3+4)",
+			implicit:           true,
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         7,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: implicit multiplication is off",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "2(3+4)",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeUnexpectedToken,
+			expectedPosition:   1,
+		},
+		{
+			name:               "calculate: conditional",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "if(1 < 2, 1/0, 5)",
+			expectedStatusCode: 201,
+			expectedError:      false,
+			expectedId:         8,
+			expectedMessage:    "",
+		},
+		{
+			name:               "calculate: imaginary number in exact precision",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1+2i",
+			precision:          "exact",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeNotExact,
+			expectedPosition:   2,
+		},
+		{
+			name:               "calculate: constant in exact precision",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "2*pi",
+			precision:          "exact",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeNotExact,
+			expectedPosition:   2,
+		},
+		{
+			name:               "calculate: function in exact precision",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1 + sin(1)",
+			precision:          "exact",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeNotExact,
+			expectedPosition:   4,
+		},
+		{
+			name:               "calculate: integer that isn't exact in floats",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "9007199254740993 & 1",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeNotExact,
+			expectedPosition:   0,
+		},
+		{
+			name:               "calculate: prefixed integer that isn't exact in floats",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1 + 0x20000000000001",
+			precision:          "complex",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeNotExact,
+			expectedPosition:   4,
+		},
+		{
+			name:               "calculate: decimal integers with leading zeros are exact",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "010 + 007 + 9007199254740993",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeNotExact,
+			expectedPosition:   12,
+		},
+		{
+			name:               "calculate: invalid precision",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1+2",
+			precision:          "double",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedMessage:    errs.ErrPrecision.Error(),
+		},
+		{
+			name:               "calculate: invalid number",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1.2.3+4",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeInvalidNumber,
+			expectedPosition:   0,
+		},
+		{
+			name:               "calculate: invalid expression",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "16+*2",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeUnexpectedToken,
+			expectedPosition:   3,
+		},
+		{
+			name:               "calculate: position with spaces",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "(1 + 2 * 3",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeBracketMismatch,
+			expectedPosition:   0,
+		},
+		{
+			name:               "calculate: invalid symbol",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "1 + 2 $ 3",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeInvalidSymbol,
+			expectedPosition:   6,
+		},
+		{
+			name:               "calculate: division by zero",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "16/0",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeDivisionByZero,
+			expectedPosition:   3,
+		},
+		{
+			name:               "calculate: modulo by zero",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "5 % 0",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedCode:       expr.CodeDivisionByZero,
+			expectedPosition:   4,
+		},
+		{
+			name:               "calculate: token expired",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                0,
+			expression:         "16+1+2",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedMessage:    errs.ErrTokenExpired.Error(),
+		},
+		{
+			name:               "calculate: invalid login",
+			login:              "roman2",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "16+1+2",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedMessage:    errs.ErrHeaderAuthorization.Error(),
+		},
+		{
+			name:               "calculate: invalid json",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			expression:         "",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedId:         0,
+			expectedMessage:    errs.ErrRequestJSON.Error(),
+		},
+	}
+
+	for _, ts := range testCalculateCases {
+		t.Run(ts.name, func(t *testing.T) {
+			token, err := auth.CreateJWTToken(ts.ttl, secret, ts.login, ts.password)
+			if err != nil {
+				t.Fatalf("error creating jwt token, error: %s", err)
+			}
+
+			req, _ := json.Marshal(models.CalculateRequest{Expression: ts.expression, Precision: ts.precision, ImplicitMultiplication: ts.implicit})
+
+			if ts.name == "calculate: invalid json" {
+				req = nil
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			w := httptest.NewRecorder()
+
+			o.Calculate(w, r)
+
+			res := w.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != ts.expectedStatusCode {
+				t.Errorf("invalid status code, got: %d, want: %d", res.StatusCode, ts.expectedStatusCode)
+			}
+			data, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Errorf("invalid reading body pf response, error: %s", err)
+			}
+			if ts.expectedCode != "" {
+				var resp models.ErrorResponse
+				if err := json.Unmarshal(data, &resp); err != nil {
+					t.Fatalf("invalid json decode, error: %s", err)
+				}
+				if resp.Code != ts.expectedCode || resp.Position != ts.expectedPosition {
+					t.Errorf("invalid expected error, got: %s at %d, want: %s at %d", resp.Code, resp.Position, ts.expectedCode, ts.expectedPosition)
+				}
+			} else if ts.expectedError {
+				message := string(data)
+				if len(message) != 0 {
+					message = message[:len(message)-1]
+				}
+
+				if message != ts.expectedMessage {
+					t.Errorf("invalid expected error, got: %s, want: %s", string(message), ts.expectedMessage)
+				}
+			} else {
+				var resp models.CalculateResponse
+				if err := json.Unmarshal(data, &resp); err != nil {
+					t.Fatalf("invalid json decode, error: %s", err)
+				}
+				if resp.Id != ts.expectedId {
+					t.Errorf("invalid expected id, got: %d, want %d", resp.Id, ts.expectedId)
+				}
+			}
+		})
+	}
+
+	t.Run("tasks: independent tasks are ready at once", func(t *testing.T) {
+		var ready int
+		db.QueryRow("SELECT COUNT(*) FROM tasks WHERE login = 'roman1' AND id_expression = 3 AND stat = 'ready'").Scan(&ready)
+		if ready != 2 {
+			t.Errorf("invalid number of ready tasks, got: %d, want: %d", ready, 2)
+		}
+
+		for id := int64(1); id <= 2; id++ {
+			if _, err := o.PostTask(context.TODO(), &task.PostTaskRequest{Login: "roman1", IdExpression: 3, IdTask: id, Result: 3}); err != nil {
+				t.Fatalf("error posting task, error: %s", err)
+			}
+		}
+
+		var stat string
+		var arg1, arg2 float64
+		db.QueryRow("SELECT stat, arg1, arg2 FROM tasks WHERE login = 'roman1' AND id_expression = 3 AND id_task = 3").Scan(&stat, &arg1, &arg2)
+		if stat != "ready" {
+			t.Errorf("invalid status of dependent task, got: %s, want: %s", stat, "ready")
+		}
+		if arg1 != 3 || arg2 != 3 {
+			t.Errorf("invalid arguments of dependent task, got: %v, %v, want: %v, %v", arg1, arg2, 3, 3)
+		}
+	})
+
+	t.Run("tasks: exact arguments and result", func(t *testing.T) {
+		var exact1, exact2 string
+		db.QueryRow("SELECT exact_arg1, exact_arg2 FROM tasks WHERE login = 'roman' AND id_expression = 3 AND id_task = 1").Scan(&exact1, &exact2)
+		if exact1 != "123456789" || exact2 != "987654321" {
+			t.Errorf("invalid exact arguments, got: %s, %s, want: %s, %s", exact1, exact2, "123456789", "987654321")
+		}
+
+		if _, err := o.PostTask(context.TODO(), &task.PostTaskRequest{Login: "roman", IdExpression: 3, IdTask: 1, Result: 1.2193263111263526e17, ExactResult: "121932631112635269"}); err != nil {
+			t.Fatalf("error posting task, error: %s", err)
+		}
+
+		var exact string
+		db.QueryRow("SELECT exact_result FROM expressions WHERE login = 'roman' AND id_expression = 3").Scan(&exact)
+		if exact != "121932631112635269" {
+			t.Errorf("invalid exact result, got: %s, want: %s", exact, "121932631112635269")
+		}
+	})
+
+	t.Run("tasks: complex arguments", func(t *testing.T) {
+		var precision string
+		db.QueryRow("SELECT precision FROM expressions WHERE login = 'roman' AND id_expression = 5").Scan(&precision)
+		if precision != "complex" {
+			t.Errorf("invalid precision, got: %s, want: %s", precision, "complex")
+		}
+
+		var arg1, imag1, arg2, imag2 float64
+		db.QueryRow("SELECT arg1, imag1, arg2, imag2 FROM tasks WHERE login = 'roman' AND id_expression = 5 AND id_task = 2").Scan(&arg1, &imag1, &arg2, &imag2)
+		if arg1 != 3 || imag1 != 0 || arg2 != 0 || imag2 != 1 {
+			t.Errorf("invalid complex arguments, got: %v%+vi, %v%+vi, want: 3+0i, 0+1i", arg1, imag1, arg2, imag2)
+		}
+	})
+
+	t.Run("tasks: unary minus is subtraction from zero", func(t *testing.T) {
+		var arg1 float64
+		var dep2 int
+		var operation string
+		db.QueryRow("SELECT arg1, dep2, operation FROM tasks WHERE login = 'roman' AND id_expression = 6 AND id_task = 2").Scan(&arg1, &dep2, &operation)
+		if arg1 != 0 || dep2 != 1 || operation != "-" {
+			t.Errorf("invalid task of unary minus, got: %v %s task %d", arg1, operation, dep2)
+		}
+	})
+
+	t.Run("tasks: only the chosen branch is scheduled", func(t *testing.T) {
+		var ready int
+		db.QueryRow("SELECT COUNT(*) FROM tasks WHERE login = 'roman' AND id_expression = 8 AND stat = 'ready'").Scan(&ready)
+		if ready != 1 {
+			t.Errorf("invalid number of ready tasks, got: %d, want: %d", ready, 1)
+		}
+
+		// the condition is false, so the division by zero is skipped
+		if _, err := o.PostTask(context.TODO(), &task.PostTaskRequest{Login: "roman", IdExpression: 8, IdTask: 1, Result: 0}); err != nil {
+			t.Fatalf("error posting task, error: %s", err)
+		}
+
+		var division, selection string
+		var arg1 float64
+		db.QueryRow("SELECT stat FROM tasks WHERE login = 'roman' AND id_expression = 8 AND id_task = 2").Scan(&division)
+		db.QueryRow("SELECT stat, arg1 FROM tasks WHERE login = 'roman' AND id_expression = 8 AND id_task = 3").Scan(&selection, &arg1)
+		if division != "skipped" || selection != "ready" || arg1 != 5 {
+			t.Errorf("invalid tasks after the condition, got: %s, %s with %v, want: skipped, ready with 5", division, selection, arg1)
+		}
+
+		if _, err := o.PostTask(context.TODO(), &task.PostTaskRequest{Login: "roman", IdExpression: 8, IdTask: 3, Result: 5}); err != nil {
+			t.Fatalf("error posting task, error: %s", err)
+		}
+		var stat string
+		db.QueryRow("SELECT stat FROM expressions WHERE login = 'roman' AND id_expression = 8").Scan(&stat)
+		if stat != "calculated" {
+			t.Errorf("invalid status of expression, got: %s, want: %s", stat, "calculated")
+		}
+	})
+
+	t.Run("scripts: bindings are computed with the script", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+		script := func(src string) *http.Response {
+			req, _ := json.Marshal(models.ScriptRequest{Script: src})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/scripts", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Script(w, r)
+			return w.Result()
+		}
+
+		res := script("a = 1; a = 2; a")
+		var errResp models.ErrorResponse
+		json.NewDecoder(res.Body).Decode(&errResp)
+		res.Body.Close()
+		if res.StatusCode != 422 || errResp.Code != expr.CodeRedefinition {
+			t.Errorf("invalid response to redefinition, got: %d %s, want: 422 %s", res.StatusCode, errResp.Code, expr.CodeRedefinition)
+		}
+
+		res = script("a = 3*4; b = a+2; a*b")
+		var resp models.CalculateResponse
+		json.NewDecoder(res.Body).Decode(&resp)
+		res.Body.Close()
+		if res.StatusCode != 201 || resp.Id != 9 {
+			t.Fatalf("invalid response, got: %d with id %d, want: 201 with id 9", res.StatusCode, resp.Id)
+		}
+
+		var dep1, dep2 int
+		db.QueryRow("SELECT dep1, dep2 FROM tasks WHERE login = 'roman' AND id_expression = 9 AND id_task = 3").Scan(&dep1, &dep2)
+		if dep1 != 1 || dep2 != 2 {
+			t.Errorf("invalid dependencies of the last statement, got: %d, %d, want: 1, 2", dep1, dep2)
+		}
+
+		for id, result := range []float64{12, 14, 168} {
+			if _, err := o.PostTask(context.TODO(), &task.PostTaskRequest{Login: "roman", IdExpression: 9, IdTask: int64(id + 1), Result: result}); err != nil {
+				t.Fatalf("error posting task, error: %s", err)
+			}
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/9", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "9"})
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.Expression(w, r)
+
+		var expression map[string]models.ExpressionResponse
+		if err := json.NewDecoder(w.Result().Body).Decode(&expression); err != nil {
+			t.Fatalf("invalid json decode, error: %s", err)
+		}
+		got := expression["expression"]
+		if got.Status != "calculated" || got.Result == nil || *got.Result != 168 {
+			t.Errorf("invalid result of script, got: %s %v, want: calculated 168", got.Status, got.Result)
+		}
+		want := []struct {
+			name  string
+			value float64
+		}{{name: "a", value: 12}, {name: "b", value: 14}}
+		if len(got.Bindings) != len(want) {
+			t.Fatalf("invalid bindings, got: %v, want: %v", got.Bindings, want)
+		}
+		for i, b := range got.Bindings {
+			if b.Name != want[i].name || b.Status != "calculated" || b.Value == nil || *b.Value != want[i].value {
+				t.Errorf("invalid binding, got: %s %s %v, want: %s calculated %v", b.Name, b.Status, b.Value, want[i].name, want[i].value)
+			}
+		}
+	})
+
+	t.Run("functions: calls are inlined at submission", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+		define := func(definition string) (int, string) {
+			req, _ := json.Marshal(models.FunctionRequest{Definition: definition})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/functions", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.AddFunction(w, r)
+			return w.Result().StatusCode, w.Body.String()
+		}
+		calculate := func(expression string) (int, string) {
+			req, _ := json.Marshal(models.CalculateRequest{Expression: expression})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Calculate(w, r)
+			return w.Result().StatusCode, w.Body.String()
+		}
+
+		if code, body := define("f(x, y) = x^2 + y"); code != 201 {
+			t.Fatalf("invalid response to definition, got: %d %s, want: 201", code, body)
+		}
+		if code, body := define("f(x) = x"); code != 422 || body != errs.ErrFunctionExists.Error()+"\n" {
+			t.Errorf("invalid response to existing function, got: %d %s, want: 422 %s", code, body, errs.ErrFunctionExists)
+		}
+		if code, body := define("g(x) = g(x) + 1"); code != 422 || !strings.Contains(body, expr.CodeRecursion) {
+			t.Errorf("invalid response to recursion, got: %d %s, want: 422 %s", code, body, expr.CodeRecursion)
+		}
+		if code, body := calculate("f(1)"); code != 422 || !strings.Contains(body, expr.CodeInvalidArity) || !strings.Contains(body, "'f'") {
+			t.Errorf("invalid response to wrong arity, got: %d %s, want: 422 %s", code, body, expr.CodeInvalidArity)
+		}
+
+		if code, body := calculate("f(3, 1) * 2"); code != 201 || body != `{"id":10}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 10", code, body)
+		}
+		var operations []string
+		rows, _ := db.Query("SELECT operation FROM tasks WHERE login = 'roman' AND id_expression = 10 ORDER BY id_task")
+		for rows.Next() {
+			var operation string
+			rows.Scan(&operation)
+			operations = append(operations, operation)
+		}
+		rows.Close()
+		if strings.Join(operations, " ") != "^ + *" {
+			t.Errorf("invalid tasks of inlined function, got: %v, want: [^ + *]", operations)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/functions", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.Functions(w, r)
+		var funcs map[string][]models.Function
+		if err := json.NewDecoder(w.Result().Body).Decode(&funcs); err != nil {
+			t.Fatalf("invalid json decode, error: %s", err)
+		}
+		if len(funcs["functions"]) != 1 || funcs["functions"][0].Body != "x^2 + y" || len(funcs["functions"][0].Params) != 2 {
+			t.Errorf("invalid functions, got: %v", funcs["functions"])
+		}
+	})
+
+	t.Run("simplify: identities are folded and common subexpressions are shared", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		req, _ := json.Marshal(models.CalculateRequest{Expression: "(sqrt(7)*1 + 0) * (sqrt(7) + 0*pi) + 2*3", Simplify: true})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.Calculate(w, r)
+		if w.Result().StatusCode != 201 || w.Body.String() != `{"id":11}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 11", w.Result().StatusCode, w.Body.String())
+		}
+
+		var count, saved int
+		var pending sql.NullFloat64
+		db.QueryRow("SELECT COUNT(*) FROM tasks WHERE login = 'roman' AND id_expression = 11").Scan(&count)
+		db.QueryRow("SELECT saved_tasks, result FROM expressions WHERE login = 'roman' AND id_expression = 11").Scan(&saved, &pending)
+		if pending.Valid {
+			t.Errorf("invalid result of a pending expression, got: %v, want: null", pending.Float64)
+		}
+		if count != 3 || saved != 6 {
+			t.Errorf("invalid number of tasks, got: %d with %d saved, want: 3 with 6 saved", count, saved)
+		}
+
+		var dep1, dep2 int
+		db.QueryRow("SELECT dep1, dep2 FROM tasks WHERE login = 'roman' AND id_expression = 11 AND id_task = 2").Scan(&dep1, &dep2)
+		if dep1 != 1 || dep2 != 1 {
+			t.Errorf("invalid dependencies of shared subexpression, got: %d, %d, want: 1, 1", dep1, dep2)
+		}
+
+		// simplification doesn't drop a division by zero, the folded divisor is rejected as a literal zero
+		req, _ = json.Marshal(models.CalculateRequest{Expression: "0/(1-1)", Simplify: true})
+		r = httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		o.Calculate(w, r)
+		if w.Result().StatusCode != 422 || !strings.Contains(w.Body.String(), expr.CodeDivisionByZero) {
+			t.Errorf("invalid response to division of zero by zero, got: %d %s", w.Result().StatusCode, w.Body.String())
+		}
+	})
+
+	t.Run("derivative: simplified derivative and its value at a point", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+		derivative := func(dreq models.DerivativeRequest) (int, string) {
+			req, _ := json.Marshal(dreq)
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/derivative", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Derivative(w, r)
+			return w.Result().StatusCode, w.Body.String()
+		}
+
+		if code, body := derivative(models.DerivativeRequest{Expression: "x^2 + 3*x", Variable: "x"}); code != 200 || body != `{"derivative":"2 * x + 3"}`+"\n" {
+			t.Errorf("invalid derivative, got: %d %s", code, body)
+		}
+		if code, body := derivative(models.DerivativeRequest{Expression: "x % 2", Variable: "x"}); code != 422 || !strings.Contains(body, expr.CodeNotDifferentiable) {
+			t.Errorf("invalid response to modulo, got: %d %s", code, body)
+		}
+		if code, body := derivative(models.DerivativeRequest{Expression: "x^2", Variable: "pi"}); code != 422 || body != errs.ErrVariableName.Error()+"\n" {
+			t.Errorf("invalid response to constant, got: %d %s", code, body)
+		}
+
+		at := 2.0
+		if code, body := derivative(models.DerivativeRequest{Expression: "x^2 + 3*x", Variable: "x", At: &at}); code != 201 || body != `{"derivative":"2 * x + 3","id":12}`+"\n" {
+			t.Fatalf("invalid derivative at a point, got: %d %s", code, body)
+		}
+		var arg1, arg2 float64
+		db.QueryRow("SELECT arg1, arg2 FROM tasks WHERE login = 'roman' AND id_expression = 12 AND id_task = 1").Scan(&arg1, &arg2)
+		if arg1 != 2 || arg2 != 2 {
+			t.Errorf("invalid arguments of the first task, got: %v, %v, want: 2, 2", arg1, arg2)
+		}
+		var expression string
+		db.QueryRow("SELECT expression FROM expressions WHERE login = 'roman' AND id_expression = 12").Scan(&expression)
+		if expression != "x = 2; 2 * x + 3" {
+			t.Errorf("invalid expression of the derivative, got: %s, want: x = 2; 2 * x + 3", expression)
+		}
+	})
+
+	t.Run("units: quantities are computed in base units", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+		calculate := func(expression string) (int, string) {
+			req, _ := json.Marshal(models.CalculateRequest{Expression: expression})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Calculate(w, r)
+			return w.Result().StatusCode, w.Body.String()
+		}
+
+		if code, body := calculate("1 m + 1 s"); code != 422 || !strings.Contains(body, expr.CodeDimensionMismatch) {
+			t.Errorf("invalid response to dimension mismatch, got: %d %s", code, body)
+		}
+		if code, body := calculate("5 km / 2 h"); code != 201 || body != `{"id":13}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 13", code, body)
+		}
+		var arg1, arg2 float64
+		var unit string
+		db.QueryRow("SELECT arg1, arg2 FROM tasks WHERE login = 'roman' AND id_expression = 13 AND id_task = 1").Scan(&arg1, &arg2)
+		db.QueryRow("SELECT unit FROM expressions WHERE login = 'roman' AND id_expression = 13").Scan(&unit)
+		if arg1 != 5000 || arg2 != 7200 || unit != "m/s" {
+			t.Errorf("invalid quantities, got: %v/%v in %s, want: 5000/7200 in m/s", arg1, arg2, unit)
+		}
+
+		if code, body := calculate("3 ft to m"); code != 201 || body != `{"id":14}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 14", code, body)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/14", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "14"})
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.Expression(w, r)
+		var expression map[string]models.ExpressionResponse
+		if err := json.NewDecoder(w.Result().Body).Decode(&expression); err != nil {
+			t.Fatalf("invalid json decode, error: %s", err)
+		}
+		if got := expression["expression"]; got.Status != "calculated" || got.Result == nil || *got.Result != 0.9144 || got.Unit != "m" {
+			t.Errorf("invalid conversion, got: %s %v %s, want: calculated 0.9144 m", got.Status, got.Result, got.Unit)
+		}
+	})
+
+	t.Run("arrays: elements are computed by separate tasks", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+		calculate := func(expression string) (int, string) {
+			req, _ := json.Marshal(models.CalculateRequest{Expression: expression})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Calculate(w, r)
+			return w.Result().StatusCode, w.Body.String()
+		}
+		// value also reports whether the response has the field result, which is only for numbers
+		value := func(id string) (string, json.RawMessage, bool) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+id, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": id})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Expression(w, r)
+			var expression map[string]models.ExpressionResponse
+			var fields map[string]map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &expression); err != nil {
+				t.Fatalf("invalid json decode, error: %s", err)
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &fields); err != nil {
+				t.Fatalf("invalid json decode, error: %s", err)
+			}
+			_, ok := fields["expression"]["result"]
+			return expression["expression"].Status, expression["expression"].Value, ok
+		}
+
+		if code, body := calculate("[1,2] + [1,2,3]"); code != 422 || !strings.Contains(body, expr.CodeShapeMismatch) {
+			t.Errorf("invalid response to shape mismatch, got: %d %s", code, body)
+		}
+
+		if code, body := calculate("[1,2,3] * 2 + [1,1,1]"); code != 201 || body != `{"id":15}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 15", code, body)
 		}
-	}
-	if res, err := db.Exec("INSERT INTO users (login, password, count_expressions) VALUES ('roman1', 'qwerty1', 0)"); err != nil {
-		t.Fatalf("error insert user, error: %s", err)
-	} else {
-		if n, _ := res.RowsAffected(); n == 0 {
-			t.Fatalf("error insert user")
+		for id, result := range []float64{2, 4, 6, 3, 5, 7} {
+			if _, err := o.PostTask(context.TODO(), &task.PostTaskRequest{Login: "roman", IdExpression: 15, IdTask: int64(id + 1), Result: result}); err != nil {
+				t.Fatalf("error posting task, error: %s", err)
+			}
+		}
+		if stat, got, result := value("15"); stat != "calculated" || string(got) != "[3,5,7]" || result {
+			t.Errorf("invalid vector, got: %s %s with result %t, want: calculated [3,5,7] without result", stat, got, result)
 		}
-	}
 
-	secret := "aspfdjspgashrgoasrnvpuasrighbousrb"
+		if code, body := calculate("transpose([[1,2],[3,4]])"); code != 201 || body != `{"id":16}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 16", code, body)
+		}
+		if stat, got, result := value("16"); stat != "calculated" || string(got) != "[[1,3],[2,4]]" || result {
+			t.Errorf("invalid transposed matrix, got: %s %s with result %t, want: calculated [[1,3],[2,4]] without result", stat, got, result)
+		}
 
-	o := orchestrator.New(secret, db)
+		if code, body := calculate("det([[1,2,3],[4,5,6],[7,8,10]])"); code != 201 || body != `{"id":17}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 17", code, body)
+		}
+		// 3 minors of 2x2 with 3 tasks each and 3 products, a sum and a difference for the first row
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM tasks WHERE login = 'roman' AND id_expression = 17").Scan(&count)
+		if count != 14 {
+			t.Errorf("invalid number of tasks of the determinant, got: %d, want: 14", count)
+		}
+	})
 
-	testCalculateCases := []struct {
+	t.Run("postfix: factorial is split into partial products", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+		calculate := func(expression, precision string) (int, string) {
+			req, _ := json.Marshal(models.CalculateRequest{Expression: expression, Precision: precision})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Calculate(w, r)
+			return w.Result().StatusCode, w.Body.String()
+		}
+
+		if code, body := calculate("200!", "float"); code != 422 || !strings.Contains(body, expr.CodeInvalidFactorial) {
+			t.Errorf("invalid response to factorial too large for floats, got: %d %s", code, body)
+		}
+		if code, body := calculate("(-3)!", "float"); code != 422 || !strings.Contains(body, expr.CodeInvalidFactorial) {
+			t.Errorf("invalid response to factorial of negative number, got: %d %s", code, body)
+		}
+		if code, body := calculate("100!", "exact"); code != 201 || body != `{"id":18}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 18", code, body)
+		}
+		// 4 partial products of 25 factors and 3 multiplications of them
+		var partial, products int
+		db.QueryRow("SELECT COUNT(*) FROM tasks WHERE login = 'roman' AND id_expression = 18 AND operation = '!' AND stat = 'ready'").Scan(&partial)
+		db.QueryRow("SELECT COUNT(*) FROM tasks WHERE login = 'roman' AND id_expression = 18 AND operation = '*'").Scan(&products)
+		if partial != 4 || products != 3 {
+			t.Errorf("invalid tasks of factorial, got: %d partial products and %d multiplications, want: 4 and 3", partial, products)
+		}
+
+		if code, body := calculate("200*15%", ""); code != 201 || body != `{"id":19}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 19", code, body)
+		}
+		var arg1, arg2 float64
+		db.QueryRow("SELECT arg1, arg2 FROM tasks WHERE login = 'roman' AND id_expression = 19 AND id_task = 1").Scan(&arg1, &arg2)
+		if arg1 != 200 || arg2 != 0.15 {
+			t.Errorf("invalid arguments of percent, got: %v, %v, want: 200, 0.15", arg1, arg2)
+		}
+	})
+
+	t.Run("bases: integer result in the requested base", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+		req, _ := json.Marshal(models.CalculateRequest{Expression: "-0xFF"})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.Calculate(w, r)
+		if code, body := w.Result().StatusCode, w.Body.String(); code != 201 || body != `{"id":20}`+"\n" {
+			t.Fatalf("invalid response, got: %d %s, want: 201 with id 20", code, body)
+		}
+
+		testBaseCases := []struct {
+			base               string
+			expectedStatusCode int
+			expectedResult     string
+		}{
+			{base: "16", expectedStatusCode: 200, expectedResult: "-0xff"},
+			{base: "2", expectedStatusCode: 200, expectedResult: "-0b11111111"},
+			{base: "8", expectedStatusCode: 200, expectedResult: "-0o377"},
+			{base: "10", expectedStatusCode: 200, expectedResult: "-255"},
+			{base: "3", expectedStatusCode: 422},
+		}
+		for _, ts := range testBaseCases {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/20?base="+ts.base, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": "20"})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Expression(w, r)
+			if w.Result().StatusCode != ts.expectedStatusCode {
+				t.Errorf("invalid status code for base %s, got: %d, want: %d", ts.base, w.Result().StatusCode, ts.expectedStatusCode)
+				continue
+			}
+			if ts.expectedStatusCode != 200 {
+				continue
+			}
+			var expression map[string]models.ExpressionResponse
+			if err := json.NewDecoder(w.Result().Body).Decode(&expression); err != nil {
+				t.Fatalf("invalid json decode, error: %s", err)
+			}
+			if got := expression["expression"].BaseResult; got != ts.expectedResult {
+				t.Errorf("invalid result in base %s, got: %s, want: %s", ts.base, got, ts.expectedResult)
+			}
+		}
+	})
+
+	t.Run("format: canonical form without tasks", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		var canonical string
+		db.QueryRow("SELECT canonical FROM expressions WHERE login = 'roman' AND id_expression = 9").Scan(&canonical)
+		if canonical != "a = 3 * 4; b = a + 2; a * b" {
+			t.Errorf("invalid canonical form of script, got: %s", canonical)
+		}
+
+		var before, after int
+		db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&before)
+
+		testFormatCases := []struct {
+			expression         string
+			implicit           string
+			expectedStatusCode int
+			expectedBody       string
+		}{
+			{expression: "((1+2))*f(3 ,1)", expectedStatusCode: 200, expectedBody: `{"canonical":"(1 + 2) * f(3, 1)"}`},
+			{expression: "2(3+x)", implicit: "true", expectedStatusCode: 200, expectedBody: `{"canonical":"2 * (3 + x)"}`},
+			{expression: "2(3+x)", implicit: "1", expectedStatusCode: 200, expectedBody: `{"canonical":"2 * (3 + x)"}`},
+			{expression: "2(3+x)", implicit: "yes", expectedStatusCode: 422, expectedBody: errs.ErrImplicit.Error()},
+			{expression: "1+*2", expectedStatusCode: 422, expectedBody: `{"code":"unexpected_token","position":2,"message":"unexpected '*'"}`},
+		}
+		for _, ts := range testFormatCases {
+			path := "/api/v1/format?expression=" + url.QueryEscape(ts.expression)
+			if ts.implicit != "" {
+				path += "&implicit_multiplication=" + ts.implicit
+			}
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Format(w, r)
+			if code, body := w.Result().StatusCode, strings.TrimSpace(w.Body.String()); code != ts.expectedStatusCode || body != ts.expectedBody {
+				t.Errorf("invalid response for %s, got: %d %s, want: %d %s", ts.expression, code, body, ts.expectedStatusCode, ts.expectedBody)
+			}
+		}
+
+		db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&after)
+		if after != before {
+			t.Errorf("format scheduled tasks, got: %d, want: %d", after, before)
+		}
+	})
+
+	t.Run("latex: formulas of expressions and results", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		testRenderCases := []struct {
+			expression         string
+			implicit           string
+			expectedStatusCode int
+			expectedLatex      string
+		}{
+			{expression: "(1+2)/3", expectedStatusCode: 200, expectedLatex: `\frac{1 + 2}{3}`},
+			{expression: "a = sqrt(2); a^2", expectedStatusCode: 200, expectedLatex: `a = \sqrt{2};\quad a^{2}`},
+			{expression: "(1+2", expectedStatusCode: 422},
+			{expression: "2(3+x)", implicit: "True", expectedStatusCode: 200, expectedLatex: `2 \cdot \left(3 + x\right)`},
+			{expression: "2(3+x)", implicit: "yes", expectedStatusCode: 422},
+		}
+		for _, ts := range testRenderCases {
+			path := "/api/v1/render?expression=" + url.QueryEscape(ts.expression)
+			if ts.implicit != "" {
+				path += "&implicit_multiplication=" + ts.implicit
+			}
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Render(w, r)
+			if w.Result().StatusCode != ts.expectedStatusCode {
+				t.Errorf("invalid status code for %s, got: %d, want: %d", ts.expression, w.Result().StatusCode, ts.expectedStatusCode)
+				continue
+			}
+			if ts.expectedStatusCode != 200 {
+				continue
+			}
+			var resp models.RenderResponse
+			if err := json.NewDecoder(w.Result().Body).Decode(&resp); err != nil {
+				t.Fatalf("invalid json decode, error: %s", err)
+			}
+			if resp.Latex != ts.expectedLatex {
+				t.Errorf("invalid formula of %s, got: %s, want: %s", ts.expression, resp.Latex, ts.expectedLatex)
+			}
+		}
+
+		testLatexCases := []struct {
+			id                  string
+			expectedLatex       string
+			expectedLatexResult string
+		}{
+			{id: "3", expectedLatex: `123456789 \cdot 987654321`, expectedLatexResult: `121932631112635269`},
+			{id: "4", expectedLatex: `-3.5`, expectedLatexResult: `-\frac{7}{2}`},
+			{id: "20", expectedLatex: `-\mathtt{0xFF}`, expectedLatexResult: `-255`},
+		}
+		for _, ts := range testLatexCases {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+ts.id+"?format=latex", nil)
+			r = mux.SetURLVars(r, map[string]string{"id": ts.id})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Expression(w, r)
+			if w.Result().StatusCode != 200 {
+				t.Errorf("invalid status code for expression %s, got: %d, want: 200", ts.id, w.Result().StatusCode)
+				continue
+			}
+			var expression map[string]models.ExpressionResponse
+			if err := json.NewDecoder(w.Result().Body).Decode(&expression); err != nil {
+				t.Fatalf("invalid json decode, error: %s", err)
+			}
+			if got := expression["expression"]; got.Latex != ts.expectedLatex || got.LatexResult != ts.expectedLatexResult {
+				t.Errorf("invalid formulas of expression %s, got: %s = %s, want: %s = %s", ts.id, got.Latex, got.LatexResult, ts.expectedLatex, ts.expectedLatexResult)
+			}
+		}
+	})
+
+	t.Run("dry run: plan without saving", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+
+		var countBefore, countAfter, tasksBefore, tasksAfter int
+		db.QueryRow("SELECT count_expressions FROM users WHERE login = 'roman'").Scan(&countBefore)
+		db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&tasksBefore)
+
+		dryRun := func(expression string) (int, string) {
+			req, _ := json.Marshal(models.CalculateRequest{Expression: expression})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate?dry_run=true", bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Calculate(w, r)
+			return w.Result().StatusCode, w.Body.String()
+		}
+
+		code, body := dryRun("(1+2)*sqrt(16)-3")
+		if code != 200 {
+			t.Fatalf("invalid status code, got: %d, want: 200", code)
+		}
+		var resp models.DryRunResponse
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatalf("invalid json decode, error: %s", err)
+		}
+		operations := make([]string, len(resp.Tasks))
+		for i, task := range resp.Tasks {
+			operations[i] = task.Operation
+		}
+		if got := strings.Join(operations, " "); got != "+ sqrt * -" {
+			t.Errorf("invalid planned tasks, got: %s, want: + sqrt * -", got)
+		}
+		if got := fmt.Sprint(resp.Edges); got != "[[1 3] [2 3] [3 4]]" {
+			t.Errorf("invalid edges, got: %s, want: [[1 3] [2 3] [3 4]]", got)
+		}
+		if resp.EstimatedTimeMs != 7 || resp.TotalTimeMs != 8 {
+			t.Errorf("invalid estimated time, got: %d and %d, want: 7 and 8", resp.EstimatedTimeMs, resp.TotalTimeMs)
+		}
+		if resp.Tasks[0].Arg1 != 1.0 || resp.Tasks[2].Arg1 != nil {
+			t.Errorf("invalid arguments, got: %v and %v, want: 1 and null", resp.Tasks[0].Arg1, resp.Tasks[2].Arg1)
+		}
+
+		if code, body := dryRun("16/0"); code != 422 || !strings.Contains(body, expr.CodeDivisionByZero) {
+			t.Errorf("invalid response for division by zero, got: %d %s", code, body)
+		}
+
+		for query, want := range map[string]int{"dry_run=1": 200, "dry_run=yes": 422} {
+			req, _ := json.Marshal(models.CalculateRequest{Expression: "1+2"})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate?"+query, bytes.NewBuffer(req))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			o.Calculate(w, r)
+			if code := w.Result().StatusCode; code != want {
+				t.Errorf("invalid status code for %s, got: %d, want: %d", query, code, want)
+			}
+			if want == 422 && w.Body.String() != errs.ErrDryRun.Error()+"\n" {
+				t.Errorf("invalid error for %s, got: %s", query, w.Body.String())
+			}
+		}
+
+		db.QueryRow("SELECT count_expressions FROM users WHERE login = 'roman'").Scan(&countAfter)
+		db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&tasksAfter)
+		if countAfter != countBefore || tasksAfter != tasksBefore {
+			t.Errorf("dry run changed the database, got: %d expressions and %d tasks, want: %d and %d", countAfter, tasksAfter, countBefore, tasksBefore)
+		}
+	})
+
+	t.Run("dry run: sign of a number is applied by the planner", func(t *testing.T) {
+		token, err := auth.CreateJWTToken(time.Hour, secret, "roman", "qwerty")
+		if err != nil {
+			t.Fatalf("error creating jwt token, error: %s", err)
+		}
+		req, _ := json.Marshal(models.CalculateRequest{Expression: "-2*3 + -2^2"})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate?dry_run=true", bytes.NewBuffer(req))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.Calculate(w, r)
+
+		var resp models.DryRunResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid json decode, error: %s", err)
+		}
+		operations := make([]string, len(resp.Tasks))
+		for i, task := range resp.Tasks {
+			operations[i] = task.Operation
+		}
+		// -2 is an argument of the multiplication, the minus of the power is subtraction from zero
+		if got := strings.Join(operations, " "); got != "* ^ - +" {
+			t.Fatalf("invalid planned tasks, got: %s, want: * ^ - +", got)
+		}
+		if resp.Tasks[0].Arg1 != -2.0 || resp.Tasks[1].Arg1 != 2.0 || resp.Tasks[2].Arg1 != 0.0 {
+			t.Errorf("invalid arguments, got: %v, %v and %v, want: -2, 2 and 0", resp.Tasks[0].Arg1, resp.Tasks[1].Arg1, resp.Tasks[2].Arg1)
+		}
+	})
+
+	testVariablesCases := []struct {
 		name               string
-		login              string
-		password           string
-		ttl                time.Duration
-		expression         string
+		method             string
+		path               string
+		body               string
 		expectedStatusCode int
-		expectedError      bool
-		expectedId         int
 		expectedMessage    string
 	}{
 		{
-			name:               "calculate: correctly1",
-			login:              "roman",
-			password:           "qwerty",
-			ttl:                time.Duration(time.Hour),
-			expression:         "1+2-3*4/5",
+			name:               "variables: add",
+			method:             http.MethodPost,
+			body:               `{"name":"rate","value":0.5}`,
 			expectedStatusCode: 201,
-			expectedError:      false,
-			expectedId:         1,
-			expectedMessage:    "",
 		},
 		{
-			name:               "calculate: correctly2",
-			login:              "roman",
-			password:           "qwerty",
-			ttl:                time.Duration(time.Hour),
-			expression:         "1+(2-3)*4/5+(-2)",
-			expectedStatusCode: 201,
-			expectedError:      false,
-			expectedId:         2,
-			expectedMessage:    "",
+			name:               "variables: add existing",
+			method:             http.MethodPost,
+			body:               `{"name":"rate","value":1}`,
+			expectedStatusCode: 422,
+			expectedMessage:    errs.ErrVariableExists.Error(),
 		},
 		{
-			name:               "calculate: correctly3",
-			login:              "roman1",
-			password:           "qwerty1",
-			ttl:                time.Duration(time.Hour),
-			expression:         "14+22-31*47/53",
-			expectedStatusCode: 201,
-			expectedError:      false,
-			expectedId:         1,
-			expectedMessage:    "",
+			name:               "variables: add constant",
+			method:             http.MethodPost,
+			body:               `{"name":"pi","value":3}`,
+			expectedStatusCode: 422,
+			expectedMessage:    errs.ErrVariableName.Error(),
 		},
 		{
-			name:               "calculate: correctly4",
-			login:              "roman1",
-			password:           "qwerty1",
-			ttl:                time.Duration(time.Hour),
-			expression:         "16+(21-33)*45/45+(-21)",
-			expectedStatusCode: 201,
-			expectedError:      false,
-			expectedId:         2,
-			expectedMessage:    "",
+			name:               "variables: get",
+			method:             http.MethodGet,
+			path:               "rate",
+			expectedStatusCode: 200,
 		},
 		{
-			name:               "calculate: invalid expression",
-			login:              "roman",
-			password:           "qwerty",
-			ttl:                time.Duration(time.Hour),
-			expression:         "16++2",
-			expectedStatusCode: 422,
-			expectedError:      true,
-			expectedId:         0,
-			expectedMessage:    errs.ErrExpression.Error(),
+			name:               "variables: get unknown",
+			method:             http.MethodGet,
+			path:               "x",
+			expectedStatusCode: 404,
+			expectedMessage:    errs.ErrVariableNotFound.Error(),
 		},
 		{
-			name:               "calculate: token expired",
-			login:              "roman",
-			password:           "qwerty",
-			ttl:                0,
-			expression:         "16+1+2",
-			expectedStatusCode: 422,
-			expectedError:      true,
-			expectedId:         0,
-			expectedMessage:    errs.ErrTokenExpired.Error(),
+			name:               "variables: update unknown",
+			method:             http.MethodPut,
+			path:               "x",
+			body:               `{"value":2}`,
+			expectedStatusCode: 404,
+			expectedMessage:    errs.ErrVariableNotFound.Error(),
 		},
 		{
-			name:               "calculate: invalid login",
-			login:              "roman2",
-			password:           "qwerty",
-			ttl:                time.Duration(time.Hour),
-			expression:         "16+1+2",
-			expectedStatusCode: 422,
-			expectedError:      true,
-			expectedId:         0,
-			expectedMessage:    errs.ErrHeaderAuthorization.Error(),
+			name:               "variables: calculate",
+			method:             http.MethodPost,
+			path:               "calculate",
+			body:               `{"expression":"200*rate+pi"}`,
+			expectedStatusCode: 201,
 		},
 		{
-			name:               "calculate: invalid json",
-			login:              "roman",
-			password:           "qwerty",
-			ttl:                time.Duration(time.Hour),
-			expression:         "",
+			name:               "variables: update",
+			method:             http.MethodPut,
+			path:               "rate",
+			body:               `{"value":2}`,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "variables: delete",
+			method:             http.MethodDelete,
+			path:               "rate",
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "variables: calculate with deleted",
+			method:             http.MethodPost,
+			path:               "calculate",
+			body:               `{"expression":"200*rate"}`,
 			expectedStatusCode: 422,
-			expectedError:      true,
-			expectedId:         0,
-			expectedMessage:    errs.ErrRequestJSON.Error(),
 		},
 	}
 
-	for _, ts := range testCalculateCases {
+	for _, ts := range testVariablesCases {
 		t.Run(ts.name, func(t *testing.T) {
-			token, err := auth.CreateJWTToken(ts.ttl, secret, ts.login, ts.password)
+			token, err := auth.CreateJWTToken(time.Hour, secret, "roman1", "qwerty1")
 			if err != nil {
 				t.Fatalf("error creating jwt token, error: %s", err)
 			}
 
-			req, _ := json.Marshal(models.CalculateRequest{Expression: ts.expression})
-
-			if ts.name == "calculate: invalid json" {
-				req = nil
-			}
-
-			r := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(req))
+			r := httptest.NewRequest(ts.method, "/api/v1/variables/"+ts.path, bytes.NewBufferString(ts.body))
+			r = mux.SetURLVars(r, map[string]string{"name": ts.path})
 			r.Header.Set("Authorization", "Bearer "+token)
 
 			w := httptest.NewRecorder()
 
-			o.Calculate(w, r)
+			switch {
+			case ts.path == "calculate":
+				o.Calculate(w, r)
+			case ts.method == http.MethodPost:
+				o.AddVariable(w, r)
+			case ts.method == http.MethodGet:
+				o.Variable(w, r)
+			case ts.method == http.MethodPut:
+				o.UpdateVariable(w, r)
+			case ts.method == http.MethodDelete:
+				o.DeleteVariable(w, r)
+			}
 
 			res := w.Result()
 			defer res.Body.Close()
@@ -194,7 +1352,7 @@ func TestOrchestrator(t *testing.T) {
 			if err != nil {
 				t.Errorf("invalid reading body pf response, error: %s", err)
 			}
-			if ts.expectedError {
+			if ts.expectedMessage != "" {
 				message := string(data)
 				if len(message) != 0 {
 					message = message[:len(message)-1]
@@ -203,18 +1361,18 @@ func TestOrchestrator(t *testing.T) {
 				if message != ts.expectedMessage {
 					t.Errorf("invalid expected error, got: %s, want: %s", string(message), ts.expectedMessage)
 				}
-			} else {
-				var resp models.CalculateResponse
-				if err := json.Unmarshal(data, &resp); err != nil {
-					t.Fatalf("invalid json decode, error: %s", err)
-				}
-				if resp.Id != ts.expectedId {
-					t.Errorf("invalid expected id, got: %d, want %d", resp.Id, ts.expectedId)
-				}
 			}
 		})
 	}
 
+	t.Run("variables: values are bound at submission", func(t *testing.T) {
+		var bound string
+		db.QueryRow("SELECT variables FROM expressions WHERE login = 'roman1' AND expression = '200*rate+pi'").Scan(&bound)
+		if bound != `{"rate":0.5}` {
+			t.Errorf("invalid bound variables, got: %s, want: %s", bound, `{"rate":0.5}`)
+		}
+	})
+
 	testExpressionsCases := []struct {
 		name               string
 		login              string
@@ -305,9 +1463,11 @@ func TestOrchestrator(t *testing.T) {
 		password           string
 		ttl                time.Duration
 		id                 int
+		format             string
 		expectedStatusCode int
 		expectedError      bool
 		expectedMessage    string
+		expectedResult     string
 	}{
 		{
 			name:               "expression: correctly1",
@@ -369,12 +1529,56 @@ func TestOrchestrator(t *testing.T) {
 			expectedError:      true,
 			expectedMessage:    errs.ErrHeaderAuthorization.Error(),
 		},
+		{
+			name:               "expression: decimal format",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			id:                 4,
+			format:             "decimal",
+			expectedStatusCode: 200,
+			expectedError:      false,
+			expectedResult:     "-3.5",
+		},
+		{
+			name:               "expression: fraction format",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			id:                 4,
+			format:             "fraction",
+			expectedStatusCode: 200,
+			expectedError:      false,
+			expectedResult:     "-7/2",
+		},
+		{
+			name:               "expression: mixed format",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			id:                 4,
+			format:             "mixed",
+			expectedStatusCode: 200,
+			expectedError:      false,
+			expectedResult:     "-3 1/2",
+		},
+		{
+			name:               "expression: invalid format",
+			login:              "roman",
+			password:           "qwerty",
+			ttl:                time.Duration(time.Hour),
+			id:                 4,
+			format:             "roman",
+			expectedStatusCode: 422,
+			expectedError:      true,
+			expectedMessage:    errs.ErrFormat.Error(),
+		},
 		{
 			name:               "expression: invalid id of expression",
 			login:              "roman",
 			password:           "qwerty",
 			ttl:                time.Duration(time.Hour),
-			id:                 3,
+			id:                 21,
 			expectedStatusCode: 404,
 			expectedError:      true,
 			expectedMessage:    errs.ErrExpressionId.Error(),
@@ -388,7 +1592,7 @@ func TestOrchestrator(t *testing.T) {
 				t.Fatalf("error creating jwt token, error: %s", err)
 			}
 
-			r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+fmt.Sprint(ts.id), nil)
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+fmt.Sprint(ts.id)+"?format="+ts.format, nil)
 
 			r = mux.SetURLVars(r, map[string]string{"id": fmt.Sprint(ts.id)})
 
@@ -417,6 +1621,14 @@ func TestOrchestrator(t *testing.T) {
 				if message != ts.expectedMessage {
 					t.Errorf("invalid expected error, got: %s, want: %s", string(message), ts.expectedMessage)
 				}
+			} else if ts.expectedResult != "" {
+				var resp map[string]models.ExpressionResponse
+				if err := json.Unmarshal(data, &resp); err != nil {
+					t.Fatalf("invalid json decode, error: %s", err)
+				}
+				if resp["expression"].ExactResult != ts.expectedResult {
+					t.Errorf("invalid result, got: %s, want: %s", resp["expression"].ExactResult, ts.expectedResult)
+				}
 			}
 		})
 	}
@@ -0,0 +1,215 @@
+package orchestrator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	errs "github.com/kingofhandsomes/calculator-go/internal/errs/orchestrator"
+	"github.com/kingofhandsomes/calculator-go/internal/expr"
+	models "github.com/kingofhandsomes/calculator-go/internal/models/orchestrator"
+)
+
+// GET /api/v1/variables
+func (o *Orchestrator) Variables(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.Variables"
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	rows, err := o.db.Query("SELECT name, value FROM variables WHERE login = $1 ORDER BY name", login)
+	if err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	vars := []models.Variable{}
+	for rows.Next() {
+		var v models.Variable
+		if err := rows.Scan(&v.Name, &v.Value); err != nil {
+			log.Printf("%s: %s\n", op, err)
+			http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+			return
+		}
+		vars = append(vars, v)
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string][]models.Variable{"variables": vars}); err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: output of all variables for the login: %s\n", op, login)
+}
+
+// GET /api/v1/variables/{name}
+func (o *Orchestrator) Variable(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.Variable"
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	v := models.Variable{Name: mux.Vars(r)["name"]}
+	err := o.db.QueryRow("SELECT value FROM variables WHERE login = $1 AND name = $2", login, v.Name).Scan(&v.Value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("%s: %s\n", op, errs.ErrVariableNotFound)
+			http.Error(w, errs.ErrVariableNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]models.Variable{"variable": v}); err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s: output of the variable %s for the login: %s\n", op, v.Name, login)
+}
+
+// POST /api/v1/variables
+func (o *Orchestrator) AddVariable(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.AddVariable"
+
+	var v models.Variable
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrRequestJSON)
+		http.Error(w, errs.ErrRequestJSON.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	if !expr.IsName(v.Name) {
+		log.Printf("%s: %s: %s\n", op, errs.ErrVariableName, v.Name)
+		http.Error(w, errs.ErrVariableName.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, err := o.db.Exec("INSERT INTO variables (login, name, value) VALUES ($1, $2, $3)", login, v.Name, v.Value); err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrVariableExists.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	log.Printf("%s: variable %s = %v for the login %s was added\n", op, v.Name, v.Value, login)
+}
+
+// PUT /api/v1/variables/{name}
+func (o *Orchestrator) UpdateVariable(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.UpdateVariable"
+
+	var v models.Variable
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		log.Printf("%s: %s\n", op, errs.ErrRequestJSON)
+		http.Error(w, errs.ErrRequestJSON.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	v.Name = mux.Vars(r)["name"]
+	res, err := o.db.Exec("UPDATE variables SET value = $1 WHERE login = $2 AND name = $3", v.Value, login, v.Name)
+	if err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("%s: %s\n", op, errs.ErrVariableNotFound)
+		http.Error(w, errs.ErrVariableNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	log.Printf("%s: variable %s = %v for the login %s was updated\n", op, v.Name, v.Value, login)
+}
+
+// DELETE /api/v1/variables/{name}
+func (o *Orchestrator) DeleteVariable(w http.ResponseWriter, r *http.Request) {
+	const op = "orchestrator.DeleteVariable"
+
+	login, ok := o.authorize(w, r, op)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	res, err := o.db.Exec("DELETE FROM variables WHERE login = $1 AND name = $2", login, name)
+	if err != nil {
+		log.Printf("%s: %s\n", op, err)
+		http.Error(w, errs.ErrServer.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("%s: %s\n", op, errs.ErrVariableNotFound)
+		http.Error(w, errs.ErrVariableNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	log.Printf("%s: variable %s for the login %s was deleted\n", op, name, login)
+}
+
+// authorize returns the login of a registered user from the header Authorization,
+// otherwise it writes the error to the response.
+func (o *Orchestrator) authorize(w http.ResponseWriter, r *http.Request, op string) (string, bool) {
+	login, err := checkJWT(r.Header.Get("Authorization"), o.secret)
+	if err != nil {
+		log.Printf("%s: %s\n", op, err)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			http.Error(w, errs.ErrTokenExpired.Error(), http.StatusUnprocessableEntity)
+			return "", false
+		}
+		http.Error(w, errs.ErrHeaderAuthorization.Error(), http.StatusUnprocessableEntity)
+		return "", false
+	}
+
+	var lg string
+	if o.db.QueryRow("SELECT login FROM users WHERE login = $1", login).Scan(&lg) != nil {
+		log.Printf("%s: unregistered user\n", op)
+		http.Error(w, errs.ErrHeaderAuthorization.Error(), http.StatusUnprocessableEntity)
+		return "", false
+	}
+	return login, true
+}
+
+// userVariables returns the values of all variables of the user.
+func userVariables(tx *sql.Tx, login string) (map[string]float64, error) {
+	rows, err := tx.Query("SELECT name, value FROM variables WHERE login = $1", login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vars := make(map[string]float64)
+	for rows.Next() {
+		var name string
+		var value float64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		vars[name] = value
+	}
+	return vars, rows.Err()
+}
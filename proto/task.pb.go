@@ -62,9 +62,14 @@ type GetTaskResponse struct {
 	Login         string                 `protobuf:"bytes,1,opt,name=login,proto3" json:"login,omitempty"`
 	IdExpression  int64                  `protobuf:"varint,2,opt,name=id_expression,json=idExpression,proto3" json:"id_expression,omitempty"`
 	IdTask        int64                  `protobuf:"varint,3,opt,name=id_task,json=idTask,proto3" json:"id_task,omitempty"`
-	Arg1          float32                `protobuf:"fixed32,4,opt,name=arg1,proto3" json:"arg1,omitempty"`
-	Arg2          float32                `protobuf:"fixed32,5,opt,name=arg2,proto3" json:"arg2,omitempty"`
+	Arg1          float64                `protobuf:"fixed64,4,opt,name=arg1,proto3" json:"arg1,omitempty"`
+	Arg2          float64                `protobuf:"fixed64,5,opt,name=arg2,proto3" json:"arg2,omitempty"`
 	Operation     string                 `protobuf:"bytes,6,opt,name=operation,proto3" json:"operation,omitempty"`
+	Precision     string                 `protobuf:"bytes,7,opt,name=precision,proto3" json:"precision,omitempty"`
+	ExactArg1     string                 `protobuf:"bytes,8,opt,name=exact_arg1,json=exactArg1,proto3" json:"exact_arg1,omitempty"`
+	ExactArg2     string                 `protobuf:"bytes,9,opt,name=exact_arg2,json=exactArg2,proto3" json:"exact_arg2,omitempty"`
+	Imag1         float64                `protobuf:"fixed64,10,opt,name=imag1,proto3" json:"imag1,omitempty"`
+	Imag2         float64                `protobuf:"fixed64,11,opt,name=imag2,proto3" json:"imag2,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -120,14 +125,14 @@ func (x *GetTaskResponse) GetIdTask() int64 {
 	return 0
 }
 
-func (x *GetTaskResponse) GetArg1() float32 {
+func (x *GetTaskResponse) GetArg1() float64 {
 	if x != nil {
 		return x.Arg1
 	}
 	return 0
 }
 
-func (x *GetTaskResponse) GetArg2() float32 {
+func (x *GetTaskResponse) GetArg2() float64 {
 	if x != nil {
 		return x.Arg2
 	}
@@ -141,13 +146,51 @@ func (x *GetTaskResponse) GetOperation() string {
 	return ""
 }
 
+func (x *GetTaskResponse) GetPrecision() string {
+	if x != nil {
+		return x.Precision
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetExactArg1() string {
+	if x != nil {
+		return x.ExactArg1
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetExactArg2() string {
+	if x != nil {
+		return x.ExactArg2
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetImag1() float64 {
+	if x != nil {
+		return x.Imag1
+	}
+	return 0
+}
+
+func (x *GetTaskResponse) GetImag2() float64 {
+	if x != nil {
+		return x.Imag2
+	}
+	return 0
+}
+
 type PostTaskRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Login         string                 `protobuf:"bytes,1,opt,name=login,proto3" json:"login,omitempty"`
 	IdExpression  int64                  `protobuf:"varint,2,opt,name=id_expression,json=idExpression,proto3" json:"id_expression,omitempty"`
 	IdTask        int64                  `protobuf:"varint,3,opt,name=id_task,json=idTask,proto3" json:"id_task,omitempty"`
 	OperationTime int64                  `protobuf:"varint,4,opt,name=operation_time,json=operationTime,proto3" json:"operation_time,omitempty"`
-	Result        float32                `protobuf:"fixed32,5,opt,name=result,proto3" json:"result,omitempty"`
+	Result        float64                `protobuf:"fixed64,5,opt,name=result,proto3" json:"result,omitempty"`
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	ExactResult   string                 `protobuf:"bytes,7,opt,name=exact_result,json=exactResult,proto3" json:"exact_result,omitempty"`
+	ImagResult    float64                `protobuf:"fixed64,8,opt,name=imag_result,json=imagResult,proto3" json:"imag_result,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -210,13 +253,34 @@ func (x *PostTaskRequest) GetOperationTime() int64 {
 	return 0
 }
 
-func (x *PostTaskRequest) GetResult() float32 {
+func (x *PostTaskRequest) GetResult() float64 {
 	if x != nil {
 		return x.Result
 	}
 	return 0
 }
 
+func (x *PostTaskRequest) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *PostTaskRequest) GetExactResult() string {
+	if x != nil {
+		return x.ExactResult
+	}
+	return ""
+}
+
+func (x *PostTaskRequest) GetImagResult() float64 {
+	if x != nil {
+		return x.ImagResult
+	}
+	return 0
+}
+
 type PostTaskResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -258,20 +322,32 @@ var File_proto_task_proto protoreflect.FileDescriptor
 const file_proto_task_proto_rawDesc = "" +
 	"\n" +
 	"\x10proto/task.proto\x12\x04task\"\x10\n" +
-	"\x0eGetTaskRequest\"\xab\x01\n" +
+	"\x0eGetTaskRequest\"\xb3\x02\n" +
 	"\x0fGetTaskResponse\x12\x14\n" +
 	"\x05login\x18\x01 \x01(\tR\x05login\x12#\n" +
 	"\rid_expression\x18\x02 \x01(\x03R\fidExpression\x12\x17\n" +
 	"\aid_task\x18\x03 \x01(\x03R\x06idTask\x12\x12\n" +
-	"\x04arg1\x18\x04 \x01(\x02R\x04arg1\x12\x12\n" +
-	"\x04arg2\x18\x05 \x01(\x02R\x04arg2\x12\x1c\n" +
-	"\toperation\x18\x06 \x01(\tR\toperation\"\xa4\x01\n" +
+	"\x04arg1\x18\x04 \x01(\x01R\x04arg1\x12\x12\n" +
+	"\x04arg2\x18\x05 \x01(\x01R\x04arg2\x12\x1c\n" +
+	"\toperation\x18\x06 \x01(\tR\toperation\x12\x1c\n" +
+	"\tprecision\x18\a \x01(\tR\tprecision\x12\x1d\n" +
+	"\n" +
+	"exact_arg1\x18\b \x01(\tR\texactArg1\x12\x1d\n" +
+	"\n" +
+	"exact_arg2\x18\t \x01(\tR\texactArg2\x12\x14\n" +
+	"\x05imag1\x18\n" +
+	" \x01(\x01R\x05imag1\x12\x14\n" +
+	"\x05imag2\x18\v \x01(\x01R\x05imag2\"\xfe\x01\n" +
 	"\x0fPostTaskRequest\x12\x14\n" +
 	"\x05login\x18\x01 \x01(\tR\x05login\x12#\n" +
 	"\rid_expression\x18\x02 \x01(\x03R\fidExpression\x12\x17\n" +
 	"\aid_task\x18\x03 \x01(\x03R\x06idTask\x12%\n" +
 	"\x0eoperation_time\x18\x04 \x01(\x03R\roperationTime\x12\x16\n" +
-	"\x06result\x18\x05 \x01(\x02R\x06result\"\x12\n" +
+	"\x06result\x18\x05 \x01(\x01R\x06result\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x12!\n" +
+	"\fexact_result\x18\a \x01(\tR\vexactResult\x12\x1f\n" +
+	"\vimag_result\x18\b \x01(\x01R\n" +
+	"imagResult\"\x12\n" +
 	"\x10PostTaskResponse2\x80\x01\n" +
 	"\vTaskService\x126\n" +
 	"\aGetTask\x12\x14.task.GetTaskRequest\x1a\x15.task.GetTaskResponse\x129\n" +
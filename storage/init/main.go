@@ -34,22 +34,97 @@ func main() {
 		expression TEXT NOT NULL,
 		stat TEXT NOT NULL,
 		result REAL NULL,
+		imag_result REAL NULL,
+		precision TEXT NOT NULL DEFAULT 'float',
+		exact_result TEXT NULL,
+		variables TEXT NULL,
+		root INTEGER NULL,
+		saved_tasks INTEGER NOT NULL DEFAULT 0,
+		unit TEXT NULL,
+		shape TEXT NULL,
+		value TEXT NULL,
+		canonical TEXT NULL,
+		latex TEXT NULL,
 		FOREIGN KEY (login) REFERENCES users(login)
 	);`
 	if _, err := db.Exec(createExpressionsTable); err != nil {
 		log.Fatalf("error when creating the expressions table: %v", err)
 	}
+	createVariablesTable := ` 
+    CREATE TABLE variables (
+		login TEXT NOT NULL,
+		name TEXT NOT NULL,
+		value REAL NOT NULL,
+		PRIMARY KEY (login, name),
+		FOREIGN KEY (login) REFERENCES users(login)
+	);`
+	if _, err := db.Exec(createVariablesTable); err != nil {
+		log.Fatalf("error when creating the variables table: %v", err)
+	}
+	createFunctionsTable := ` 
+    CREATE TABLE functions (
+		login TEXT NOT NULL,
+		name TEXT NOT NULL,
+		params TEXT NOT NULL,
+		body TEXT NOT NULL,
+		PRIMARY KEY (login, name),
+		FOREIGN KEY (login) REFERENCES users(login)
+	);`
+	if _, err := db.Exec(createFunctionsTable); err != nil {
+		log.Fatalf("error when creating the functions table: %v", err)
+	}
+	createBindingsTable := ` 
+    CREATE TABLE bindings (
+		login TEXT NOT NULL,
+		id_expression INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		id_task INTEGER NULL,
+		result REAL NULL,
+		imag_result REAL NULL,
+		exact_result TEXT NULL,
+		unit TEXT NULL,
+		FOREIGN KEY (login) REFERENCES users(login)
+	);`
+	if _, err := db.Exec(createBindingsTable); err != nil {
+		log.Fatalf("error when creating the bindings table: %v", err)
+	}
+	createElementsTable := ` 
+    CREATE TABLE elements (
+		login TEXT NOT NULL,
+		id_expression INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		id_task INTEGER NULL,
+		result REAL NULL,
+		imag_result REAL NULL,
+		exact_result TEXT NULL,
+		FOREIGN KEY (login) REFERENCES users(login)
+	);`
+	if _, err := db.Exec(createElementsTable); err != nil {
+		log.Fatalf("error when creating the elements table: %v", err)
+	}
 	createTasksTable := ` 
     CREATE TABLE tasks (
 		login TEXT NOT NULL,
 		id_expression INTEGER NOT NULL,
 		id_task INTEGER NOT NULL,
-		arg1 REAL NOT NULL,
-		arg2 REAL NOT NULL,
+		arg1 REAL NULL,
+		arg2 REAL NULL,
+		imag1 REAL NULL,
+		imag2 REAL NULL,
+		exact_arg1 TEXT NULL,
+		exact_arg2 TEXT NULL,
+		dep1 INTEGER NULL,
+		dep2 INTEGER NULL,
+		cond INTEGER NULL,
+		branch INTEGER NULL,
 		operation STRING NOT NULL,
+		precision TEXT NOT NULL DEFAULT 'float',
 		stat STRING NOT NULL,
 		operation_time INTEGER NULL,
-		result REAL NULL
+		result REAL NULL,
+		imag_result REAL NULL,
+		exact_result TEXT NULL
 	);`
 	if _, err := db.Exec(createTasksTable); err != nil {
 		log.Fatalf("error when creating the tasks table: %v", err)